@@ -0,0 +1,148 @@
+package sprinkler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"go.viam.com/rdk/logging"
+)
+
+// DefaultDepletionThreshold is how much of the soil's available water a zone
+// can use up before we water it, if the zone doesn't say.
+const DefaultDepletionThreshold = 0.5
+
+// waterBalance is a soil moisture bucket per zone. Every day the bucket loses
+// the crop's evapotranspiration, gains rain and whatever we watered, and once
+// it's down past the threshold we water just enough to fill it back up.
+type waterBalance struct {
+	Day       string             // the last day we updated, YYYY-MM-DD
+	Depletion map[string]float64 // mm of water the zone is below full
+	Target    map[string]float64 // minutes to water on Day
+
+	ForecastRainMM float64 // the rain we counted on Day, replaced with what really fell once we know
+}
+
+func waterBalanceFileName(root string) string {
+	return filepath.Join(root, "balance.json")
+}
+
+func loadWaterBalance(root string, logger logging.Logger) (*waterBalance, error) {
+	wb, _, err := loadJSONFile[*waterBalance](root, waterBalanceFileName(root), logger)
+	if err != nil {
+		return nil, err
+	}
+	if wb == nil {
+		wb = &waterBalance{}
+	}
+
+	if wb.Depletion == nil {
+		wb.Depletion = map[string]float64{}
+	}
+	if wb.Target == nil {
+		wb.Target = map[string]float64{}
+	}
+	return wb, nil
+}
+
+func (wb *waterBalance) save(root string) error {
+	data, err := json.MarshalIndent(wb, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(waterBalanceFileName(root), data)
+}
+
+func dayString(now time.Time) string {
+	return now.Format("2006-01-02")
+}
+
+// update moves the bucket for one zone forward a day and figures out how long to water
+// et: mm of crop evapotranspiration, rain: mm of rain, applied: mm we watered
+func (wb *waterBalance) update(zone string, z ZoneConfig, et, rain, applied float64) {
+	d := wb.Depletion[zone] + et - rain - applied
+	d = max(0, min(d, z.capacity()))
+	wb.Depletion[zone] = d
+
+	if d >= z.depletionThreshold()*z.capacity() {
+		wb.Target[zone] = 60 * d / z.ApplicationRateMMPerHour
+	} else {
+		wb.Target[zone] = 0
+	}
+}
+
+// observed is the rain that actually fell over the last day, if we have it
+func (s *sprinkler) updateWaterBalance_inlock(now time.Time, w weatherSummary, observed float64, haveObserved bool) error {
+	today := dayString(now)
+	if s.balance.Day == today || !s.config.usesWaterBalance() {
+		return nil
+	}
+
+	lat, err := strconv.ParseFloat(s.config.Lat, 64)
+	if err != nil {
+		return fmt.Errorf("bad lat [%s] for water balance: %w", s.config.Lat, err)
+	}
+
+	et0 := hargreavesET0(w.MinTemp, w.MaxTemp, lat, now)
+	yesterday := now.AddDate(0, 0, -1)
+
+	rain := w.RainMM
+	if haveObserved {
+		// yesterday we guessed ForecastRainMM, now we know what really fell
+		rain += observed - s.balance.ForecastRainMM
+	}
+
+	for n, z := range s.config.Zones {
+		if !z.usesWaterBalance() {
+			continue
+		}
+
+		l, err := s.ledger_inlock(n, yesterday)
+		if err != nil {
+			return err
+		}
+		// time marked done by hand was watered some other way
+		applied := max(0, (l.Ran+l.Mark).Hours()*z.ApplicationRateMMPerHour)
+
+		s.balance.update(n, z, et0*z.CropCoefficient, rain, applied)
+		s.logger.Infof("zone %s et0: %0.2fmm rain: %0.2fmm applied: %0.2fmm depletion: %0.2fmm target: %0.1f minutes",
+			n, et0, rain, applied, s.balance.Depletion[n], s.balance.Target[n])
+	}
+
+	s.balance.Day = today
+	s.balance.ForecastRainMM = w.RainMM
+	return s.balance.save(s.config.DataDir)
+}
+
+// hargreavesET0 is the reference evapotranspiration in mm/day from the daily
+// min and max temperature (FAO-56 equation 52).
+func hargreavesET0(minTemp, maxTemp, latDegrees float64, day time.Time) float64 {
+	if maxTemp < minTemp {
+		minTemp, maxTemp = maxTemp, minTemp
+	}
+	mean := (minTemp + maxTemp) / 2
+	et := 0.0023 * (mean + 17.8) * math.Sqrt(maxTemp-minTemp) * extraterrestrialRadiation(latDegrees, day)
+	return max(0, et)
+}
+
+// extraterrestrialRadiation is Ra in mm/day of evaporation equivalent (FAO-56 equation 21).
+func extraterrestrialRadiation(latDegrees float64, day time.Time) float64 {
+	const solarConstant = 0.0820 // MJ m-2 min-1
+
+	lat := latDegrees * math.Pi / 180
+	j := float64(day.YearDay())
+
+	dr := 1 + 0.033*math.Cos(2*math.Pi*j/365)
+	declination := 0.409 * math.Sin(2*math.Pi*j/365-1.39)
+
+	x := -math.Tan(lat) * math.Tan(declination)
+	sunset := math.Acos(max(-1, min(1, x)))
+
+	ra := (24 * 60 / math.Pi) * solarConstant * dr *
+		(sunset*math.Sin(lat)*math.Sin(declination) + math.Cos(lat)*math.Cos(declination)*math.Sin(sunset))
+
+	return 0.408 * ra
+}
@@ -0,0 +1,180 @@
+package sprinkler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/logging"
+
+	"go.viam.com/test"
+)
+
+func TestHargreaves(t *testing.T) {
+	summer := time.Date(2026, time.June, 21, 0, 0, 0, 0, time.UTC)
+	winter := time.Date(2026, time.December, 21, 0, 0, 0, 0, time.UTC)
+
+	// a warm summer day around new york is 5-6mm
+	et := hargreavesET0(18, 30, 40.5, summer)
+	test.That(t, et, test.ShouldBeBetween, 5, 6)
+
+	test.That(t, hargreavesET0(-2, 5, 40.5, winter), test.ShouldBeLessThan, 1)
+	test.That(t, hargreavesET0(30, 18, 40.5, summer), test.ShouldAlmostEqual, et)
+	test.That(t, hargreavesET0(20, 20, 40.5, summer), test.ShouldEqual, 0)
+
+	// the sun never sets/rises at the poles in summer/winter
+	test.That(t, extraterrestrialRadiation(80, summer), test.ShouldBeGreaterThan, 15)
+	test.That(t, extraterrestrialRadiation(80, winter), test.ShouldEqual, 0)
+}
+
+func TestWaterBalanceUpdate(t *testing.T) {
+	z := ZoneConfig{
+		CropCoefficient:          0.8,
+		RootDepthMM:              150,
+		AvailableWater:           0.2, // 30mm capacity
+		ApplicationRateMMPerHour: 12,
+	}
+
+	wb := &waterBalance{Depletion: map[string]float64{}, Target: map[string]float64{}}
+
+	wb.update("a", z, 5, 0, 0)
+	test.That(t, wb.Depletion["a"], test.ShouldEqual, 5)
+	test.That(t, wb.Target["a"], test.ShouldEqual, 0)
+
+	wb.update("a", z, 5, 2, 0)
+	test.That(t, wb.Depletion["a"], test.ShouldEqual, 8)
+
+	// past half of capacity, refill it
+	wb.update("a", z, 8, 0, 0)
+	test.That(t, wb.Depletion["a"], test.ShouldEqual, 16)
+	test.That(t, wb.Target["a"], test.ShouldEqual, 80)
+
+	wb.update("a", z, 4, 0, 16)
+	test.That(t, wb.Depletion["a"], test.ShouldEqual, 4)
+	test.That(t, wb.Target["a"], test.ShouldEqual, 0)
+
+	// a big rain can't make it wetter than full, and it can't get drier than empty
+	wb.update("a", z, 4, 50, 0)
+	test.That(t, wb.Depletion["a"], test.ShouldEqual, 0)
+	wb.update("a", z, 100, 0, 0)
+	test.That(t, wb.Depletion["a"], test.ShouldEqual, 30)
+}
+
+func TestWaterBalanceSchedule(t *testing.T) {
+	ctx := context.Background()
+	s := sprinkler{
+		config: &sprinklerConfig{
+			StartHour: -1,
+			Lat:       "40.5",
+			Long:      "-73.5",
+			Zones: map[string]ZoneConfig{
+				"lawn": {
+					CropCoefficient:          0.8,
+					RootDepthMM:              150,
+					AvailableWater:           0.2,
+					ApplicationRateMMPerHour: 12,
+				},
+				"beds": {Minutes: 5},
+			},
+		},
+		logger: logging.NewTestLogger(t),
+	}
+	f := addDummyPins(&s)
+	defer f()
+
+	day := time.Date(2026, time.June, 21, 4, 0, 0, 0, time.UTC)
+
+	// no weather yet today, so the lawn doesn't know to water
+	test.That(t, s.targetMinutes_inlock("lawn", day), test.ShouldEqual, 0)
+	test.That(t, s.pickNext_inlock(day), test.ShouldResemble, []string{"beds"})
+
+	s.balance.Depletion["lawn"] = 12
+	test.That(t, s.updateWaterBalance_inlock(day, weatherSummary{RainMM: 1, MinTemp: 18, MaxTemp: 30}, 0, false), test.ShouldBeNil)
+	test.That(t, s.balance.Depletion["lawn"], test.ShouldBeBetween, 15, 16)
+	test.That(t, s.targetMinutes_inlock("lawn", day), test.ShouldAlmostEqual, 60*s.balance.Depletion["lawn"]/12)
+
+	// a second update on the same day doesn't count et twice
+	before := s.balance.Depletion["lawn"]
+	test.That(t, s.updateWaterBalance_inlock(day, weatherSummary{MinTemp: 18, MaxTemp: 30}, 0, false), test.ShouldBeNil)
+	test.That(t, s.balance.Depletion["lawn"], test.ShouldEqual, before)
+
+	s.lastRainCheck = day.Add(time.Hour)
+	test.That(t, s.doLoop(ctx, day), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldResemble, []string{"beds"})
+	test.That(t, s.doLoop(ctx, day.Add(6*time.Minute)), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldResemble, []string{"lawn"})
+
+	readings, err := s.Readings(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, readings["lawn-depletion-mm"], test.ShouldEqual, before)
+
+	// it survives a restart
+	wb, err := loadWaterBalance(s.config.DataDir, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, wb.Depletion["lawn"], test.ShouldEqual, before)
+
+	// whatever we watered yesterday gets credited the next day
+	ran, err := s.stats.AmountWatered("lawn", day)
+	test.That(t, err, test.ShouldBeNil)
+	_, err = s.stats.AddWatered("lawn", day, 60*time.Minute-ran)
+	test.That(t, err, test.ShouldBeNil)
+	tomorrow := day.AddDate(0, 0, 1)
+	test.That(t, s.updateWaterBalance_inlock(tomorrow, weatherSummary{MinTemp: 18, MaxTemp: 18}, 0, false), test.ShouldBeNil)
+	test.That(t, s.balance.Depletion["lawn"], test.ShouldAlmostEqual, before-12)
+}
+
+func TestWaterBalanceObservedRain(t *testing.T) {
+	s := sprinkler{
+		config: &sprinklerConfig{
+			Lat:  "40.5",
+			Long: "-73.5",
+			Zones: map[string]ZoneConfig{
+				"lawn": {
+					CropCoefficient:          1,
+					RootDepthMM:              150,
+					AvailableWater:           0.2,
+					ApplicationRateMMPerHour: 12,
+				},
+			},
+		},
+		logger: logging.NewTestLogger(t),
+	}
+	f := addDummyPins(&s)
+	defer f()
+
+	day := time.Date(2026, time.June, 21, 4, 0, 0, 0, time.UTC)
+	flat := weatherSummary{MinTemp: 20, MaxTemp: 20} // no et
+
+	s.balance.Depletion["lawn"] = 20
+	test.That(t, s.updateWaterBalance_inlock(day, weatherSummary{RainMM: 8, MinTemp: 20, MaxTemp: 20}, 0, false), test.ShouldBeNil)
+	test.That(t, s.balance.Depletion["lawn"], test.ShouldEqual, 12)
+
+	// only 2mm of the 8 we were promised actually fell
+	test.That(t, s.updateWaterBalance_inlock(day.AddDate(0, 0, 1), flat, 2, true), test.ShouldBeNil)
+	test.That(t, s.balance.Depletion["lawn"], test.ShouldEqual, 18)
+}
+
+func TestWaterBalanceValidate(t *testing.T) {
+	cfg := sprinklerConfig{
+		Board: "b",
+		Zones: map[string]ZoneConfig{
+			"lawn": {ApplicationRateMMPerHour: 12},
+		},
+	}
+	_, _, err := cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	cfg.Zones["lawn"] = ZoneConfig{
+		CropCoefficient:          0.8,
+		RootDepthMM:              150,
+		AvailableWater:           0.2,
+		ApplicationRateMMPerHour: 12,
+	}
+	_, _, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	cfg.Lat = "40.5"
+	cfg.Long = "-73.5"
+	_, _, err = cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"go.viam.com/rdk/components/sensor"
+	toggleswitch "go.viam.com/rdk/components/switch"
 	"go.viam.com/rdk/module"
 	"go.viam.com/rdk/resource"
 
@@ -11,5 +12,6 @@ import (
 func main() {
 	module.ModularMain(
 		resource.APIModel{sensor.API, sprinkler.SprinklerModel},
+		resource.APIModel{toggleswitch.API, sprinkler.ZoneModel},
 	)
 }
@@ -2,44 +2,346 @@ package sprinkler
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"go.viam.com/rdk/logging"
 )
 
 type DataAPI interface {
+	// how long the zone actually ran today
 	AmountWatered(z string, now time.Time) (time.Duration, error)
 
 	// returns the total amount watered today
 	AddWatered(z string, now time.Time, amountToMark time.Duration) (time.Duration, error)
+
+	// adds to one kind of adjustment for the zone today, returns today's total of that kind
+	AddAdjustment(z, kind string, now time.Time, amount time.Duration) (time.Duration, error)
+
+	// today's adjustments for the zone by kind
+	Adjustments(z string, now time.Time) (map[string]time.Duration, error)
+
+	// returns the total liters used today
+	AddVolume(z string, now time.Time, liters float64) (float64, error)
+
+	// liters used on the days from through to
+	VolumeUsed(z string, from, to time.Time) (float64, error)
+
+	// appends to the event log
+	AddEvent(e Event) error
+
+	// events from through to, oldest first
+	Events(from, to time.Time) ([]Event, error)
+
+	// saves the weather we adjusted the zones for
+	AddWeather(w WeatherSnapshot) error
+
+	// weather snapshots from through to, oldest first
+	Weather(from, to time.Time) ([]WeatherSnapshot, error)
+
+	// the zone's totals for each day from through to
+	History(z string, from, to time.Time) ([]DayTotal, error)
+
+	// makes sure everything so far is on disk
+	Flush() error
+
+	Close() error
+}
+
+// WeatherSnapshot is the weather we went by when adjusting the zones for the day
+type WeatherSnapshot struct {
+	Time       time.Time `json:"time"`
+	RainMM     float64   `json:"rain_mm"`     // forecast for the next day
+	ObservedMM float64   `json:"observed_mm"` // what fell the last day, if we know
+	MinTemp    float64   `json:"min_temp"`
+	MaxTemp    float64   `json:"max_temp"`
+}
+
+func startOfDay(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+}
+
+// startOfWeek is the monday of this week
+func startOfWeek(now time.Time) time.Time {
+	return startOfDay(now).AddDate(0, 0, -((int(now.Weekday()) + 6) % 7))
+}
+
+func startOfMonth(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
 }
 
 // ----
 
 type durData map[string]time.Duration
 
+type volData map[string]float64
+
 type localJSONStore struct {
 	root          string
+	logger        logging.Logger
 	data          map[string]time.Duration // how many minutes each zone has been running
 	filenamePrint map[string]bool
+
+	// with a flush interval, days being written to are kept here and written
+	// out every interval instead of on every change
+	flushInterval time.Duration
+	lock          sync.Mutex
+	cache         map[string]*cachedFile // by file name
+	today         string                 // the day of the last write, older days are dropped on flush
+	stop          chan struct{}
+	stopped       chan struct{}
+
+	appendLock sync.Mutex // events come from both the loop and the valves
 }
 
-func NewLocalJSONStore(root string) (DataAPI, error) {
-	s := &localJSONStore{root: root}
+type cachedFile struct {
+	dur   durData // one of these
+	vol   volData
+	dirty bool
+}
+
+// DefaultFlushSeconds is how often the day's totals are written out, that's the most a crash can lose
+const DefaultFlushSeconds = 60
+
+// NewLocalJSONStore writes every change straight to disk
+func NewLocalJSONStore(root string, logger logging.Logger) (DataAPI, error) {
+	return newLocalJSONStore(root, 0, logger)
+}
+
+// newLocalJSONStore keeps changes in memory for up to flushInterval, 0 writes them straight through
+func newLocalJSONStore(root string, flushInterval time.Duration, logger logging.Logger) (*localJSONStore, error) {
+	s := &localJSONStore{root: root, flushInterval: flushInterval, logger: logger}
 	s.data = map[string]time.Duration{}
 	s.filenamePrint = map[string]bool{}
+	s.cache = map[string]*cachedFile{}
+
+	err := s.check()
+	if err != nil {
+		return nil, err
+	}
+
+	if flushInterval > 0 {
+		s.stop = make(chan struct{})
+		s.stopped = make(chan struct{})
+		go s.flushLoop()
+	}
 	return s, nil
 }
 
+func (s *localJSONStore) flushLoop() {
+	defer close(s.stopped)
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			err := s.Flush()
+			if err != nil {
+				s.logger.Errorf("cannot flush %v: %v", s.root, err)
+			}
+		}
+	}
+}
+
+// Flush writes out everything that's changed since the last flush
+func (s *localJSONStore) Flush() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var errs []error
+	for fn, c := range s.cache {
+		if c.dirty {
+			data := dataOut(c.dur)
+			if c.vol != nil {
+				data = volumeOut(c.vol)
+			}
+			err := writeFileAtomic(fn, []byte(data))
+			if err != nil {
+				// keep it dirty and try again next time
+				errs = append(errs, err)
+				continue
+			}
+			c.dirty = false
+		}
+		if !strings.Contains(filepath.Base(fn), s.today) {
+			delete(s.cache, fn)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// cached is true if writes for now's day go to the cache
+func (s *localJSONStore) cached_inlock(now time.Time) bool {
+	if s.flushInterval == 0 {
+		return false
+	}
+	s.today = dayString(now)
+	return true
+}
+
+// repairs are the daily files check knows how to read, by prefix. Each
+// returns the good part of the file, and an error if there was a bad part.
+var repairs = map[string]func(raw string) (string, error){
+	"data": func(raw string) (string, error) {
+		dd, err := dataIn(raw)
+		return dataOut(dd), err
+	},
+	"adjust": func(raw string) (string, error) {
+		dd, err := dataIn(raw)
+		return dataOut(dd), err
+	},
+	"volume": func(raw string) (string, error) {
+		vd, err := volumeIn(raw)
+		return volumeOut(vd), err
+	},
+	"events":  repairJSONLines,
+	"weather": repairJSONLines,
+}
+
+// check cleans up after a crash: it removes half written temp files, and
+// moves files it can't read to quarantine/, keeping whatever lines were good.
+func (s *localJSONStore) check() error {
+	entries, err := os.ReadDir(s.root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		fn := filepath.Join(s.root, name)
+
+		if strings.Contains(name, ".tmp") {
+			s.logger.Warnf("removing partial write %v", fn)
+			os.Remove(fn)
+			continue
+		}
+
+		prefix, _, _ := strings.Cut(name, "-")
+		repair, ok := repairs[prefix]
+		if !ok || !strings.HasSuffix(name, ".txt") {
+			continue
+		}
+
+		raw, err := os.ReadFile(fn)
+		good := ""
+		if err == nil {
+			good, err = repair(string(raw))
+		}
+		if err == nil {
+			continue
+		}
+
+		s.logger.Warnf("quarantining %v: %v", fn, err)
+		err = s.quarantine(fn, good)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// quarantine moves a bad file out of the way, and writes back the part we could read
+func (s *localJSONStore) quarantine(fn, good string) error {
+	err := quarantineFile(s.root, fn)
+	if err != nil {
+		return err
+	}
+
+	if good == "" {
+		return nil
+	}
+	return writeFileAtomic(fn, []byte(good))
+}
+
+// quarantineFile moves fn into root/quarantine/ so someone can look at it later
+func quarantineFile(root, fn string) error {
+	dir := filepath.Join(root, "quarantine")
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return os.Rename(fn, filepath.Join(dir, fmt.Sprintf("%s.%d", filepath.Base(fn), time.Now().Unix())))
+}
+
+// loadJSONFile reads one of the json files in root. It's false if there isn't
+// one, and one we can't parse is quarantined, so we start over instead of not at all.
+func loadJSONFile[T any](root, fn string, logger logging.Logger) (T, bool, error) {
+	var v T
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return v, false, nil
+		}
+		return v, false, err
+	}
+
+	err = json.Unmarshal(data, &v)
+	if err != nil {
+		logger.Warnf("quarantining %v: %v", fn, err)
+		var empty T
+		return empty, false, quarantineFile(root, fn)
+	}
+	return v, true, nil
+}
+
+func (s *localJSONStore) AddWeather(w WeatherSnapshot) error {
+	line, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+	return s.appendLine("weather", w.Time, line)
+}
+
+func (s *localJSONStore) Weather(from, to time.Time) ([]WeatherSnapshot, error) {
+	all, err := readJSONLines[WeatherSnapshot](s, "weather", from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []WeatherSnapshot{}
+	for _, w := range all {
+		if !w.Time.Before(from) && !w.Time.After(to) {
+			res = append(res, w)
+		}
+	}
+	return res, nil
+}
+
+// Close writes out whatever is still in memory
+func (s *localJSONStore) Close() error {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.stopped
+		s.stop = nil
+	}
+	return s.Flush()
+}
+
 func (s *localJSONStore) fileName(now time.Time) string {
-	return filepath.Join(s.root, fmt.Sprintf("data-%d-%02d-%02d.txt", now.Year(), now.Month(), now.Day()))
+	return s.prefixFileName("data", now)
+}
+
+func (s *localJSONStore) prefixFileName(prefix string, now time.Time) string {
+	return filepath.Join(s.root, fmt.Sprintf("%s-%d-%02d-%02d.txt", prefix, now.Year(), now.Month(), now.Day()))
 }
 
-func (s *localJSONStore) readFromDisk(now time.Time) (durData, error) {
-	fn := s.fileName(now)
+func (s *localJSONStore) readFromDisk(prefix string, now time.Time) (durData, error) {
+	fn := s.prefixFileName(prefix, now)
+	if c, ok := s.cache[fn]; ok {
+		return c.dur, nil
+	}
 
 	data, err := os.ReadFile(fn)
 	if err != nil {
@@ -49,21 +351,33 @@ func (s *localJSONStore) readFromDisk(now time.Time) (durData, error) {
 		return nil, err
 	}
 
-	return dataIn(string(data))
+	dd, err := dataIn(string(data))
+	if err != nil {
+		// keep what we can, the next write fixes the file
+		s.logger.Warnf("skipping bad lines in %v: %v", fn, err)
+	}
+	return dd, nil
 }
 
-func (s *localJSONStore) writeToDisk(now time.Time, dd durData) error {
-	fn := s.fileName(now)
+func (s *localJSONStore) writeToDisk(prefix string, now time.Time, dd durData) error {
+	fn := s.prefixFileName(prefix, now)
+	if s.cached_inlock(now) {
+		s.cache[fn] = &cachedFile{dur: dd, dirty: true}
+		return nil
+	}
 	if !s.filenamePrint[fn] {
 		fmt.Printf("writing to %v\n", fn)
 		s.filenamePrint[fn] = true
 	}
 	data := dataOut(dd)
-	return os.WriteFile(fn, []byte(data), 0666)
+	return writeFileAtomic(fn, []byte(data))
 }
 
 func (s *localJSONStore) AmountWatered(z string, now time.Time) (time.Duration, error) {
-	dd, err := s.readFromDisk(now)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	dd, err := s.readFromDisk("data", now)
 	if err != nil {
 		return 0, err
 	}
@@ -72,7 +386,10 @@ func (s *localJSONStore) AmountWatered(z string, now time.Time) (time.Duration,
 }
 
 func (s *localJSONStore) AddWatered(z string, now time.Time, amountToMark time.Duration) (time.Duration, error) {
-	dd, err := s.readFromDisk(now)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	dd, err := s.readFromDisk("data", now)
 	if err != nil {
 		return 0, err
 	}
@@ -81,7 +398,101 @@ func (s *localJSONStore) AddWatered(z string, now time.Time, amountToMark time.D
 	d += amountToMark
 	dd[z] = d
 
-	return d, s.writeToDisk(now, dd)
+	return d, s.writeToDisk("data", now, dd)
+}
+
+// adjustments are kept out of the data file so it's only real time, keyed zone:kind
+func adjustmentKey(z, kind string) string {
+	return z + ":" + kind
+}
+
+func (s *localJSONStore) AddAdjustment(z, kind string, now time.Time, amount time.Duration) (time.Duration, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	dd, err := s.readFromDisk("adjust", now)
+	if err != nil {
+		return 0, err
+	}
+
+	k := adjustmentKey(z, kind)
+	dd[k] += amount
+
+	return dd[k], s.writeToDisk("adjust", now, dd)
+}
+
+func (s *localJSONStore) Adjustments(z string, now time.Time) (map[string]time.Duration, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	dd, err := s.readFromDisk("adjust", now)
+	if err != nil {
+		return nil, err
+	}
+
+	res := map[string]time.Duration{}
+	for k, v := range dd {
+		zone, kind, ok := strings.Cut(k, ":")
+		if ok && zone == z {
+			res[kind] = v
+		}
+	}
+	return res, nil
+}
+
+func (s *localJSONStore) readVolumeFromDisk(now time.Time) (volData, error) {
+	fn := s.prefixFileName("volume", now)
+	if c, ok := s.cache[fn]; ok {
+		return c.vol, nil
+	}
+
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return volData{}, nil
+		}
+		return nil, err
+	}
+
+	vd, err := volumeIn(string(data))
+	if err != nil {
+		s.logger.Warnf("skipping bad lines in %v: %v", fn, err)
+	}
+	return vd, nil
+}
+
+func (s *localJSONStore) AddVolume(z string, now time.Time, liters float64) (float64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	vd, err := s.readVolumeFromDisk(now)
+	if err != nil {
+		return 0, err
+	}
+
+	vd[z] += liters
+
+	fn := s.prefixFileName("volume", now)
+	if s.cached_inlock(now) {
+		s.cache[fn] = &cachedFile{vol: vd, dirty: true}
+		return vd[z], nil
+	}
+	return vd[z], writeFileAtomic(fn, []byte(volumeOut(vd)))
+}
+
+func (s *localJSONStore) VolumeUsed(z string, from, to time.Time) (float64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	total := 0.0
+	for d := startOfDay(from); !d.After(to); d = d.AddDate(0, 0, 1) {
+		vd, err := s.readVolumeFromDisk(d)
+		if err != nil {
+			return 0, err
+		}
+		total += vd[z]
+	}
+	return total, nil
 }
 
 func dataOut(data durData) string {
@@ -94,8 +505,10 @@ func dataOut(data durData) string {
 	return buffer.String()
 }
 
+// dataIn returns every line it could read, and an error about the ones it couldn't
 func dataIn(raw string) (durData, error) {
 	dd := durData{}
+	var errs []error
 
 	for _, l := range strings.Split(raw, "\n") {
 		l = strings.TrimSpace(l)
@@ -104,15 +517,167 @@ func dataIn(raw string) (durData, error) {
 		}
 		x := strings.Split(l, " ")
 		if len(x) != 2 {
-			return dd, fmt.Errorf("invalid data line [%s]", l)
+			errs = append(errs, fmt.Errorf("invalid data line [%s]", l))
+			continue
 		}
 
 		f, err := strconv.ParseFloat(x[1], 64)
 		if err != nil {
-			return dd, fmt.Errorf("invalid data line [%s]", l)
+			errs = append(errs, fmt.Errorf("invalid data line [%s]", l))
+			continue
 		}
 		dd[x[0]] = time.Duration(f * float64(time.Minute))
 
 	}
-	return dd, nil
+	return dd, errors.Join(errs...)
+}
+
+func volumeOut(data volData) string {
+	var buffer bytes.Buffer
+
+	for k, v := range data {
+		buffer.WriteString(fmt.Sprintf("%s %.03f\n", k, v))
+	}
+
+	return buffer.String()
+}
+
+// volumeIn returns every line it could read, and an error about the ones it couldn't
+func volumeIn(raw string) (volData, error) {
+	vd := volData{}
+	var errs []error
+
+	for _, l := range strings.Split(raw, "\n") {
+		l = strings.TrimSpace(l)
+		if len(l) == 0 {
+			continue
+		}
+		x := strings.Split(l, " ")
+		if len(x) != 2 {
+			errs = append(errs, fmt.Errorf("invalid volume line [%s]", l))
+			continue
+		}
+
+		f, err := strconv.ParseFloat(x[1], 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid volume line [%s]", l))
+			continue
+		}
+		vd[x[0]] = f
+	}
+	return vd, errors.Join(errs...)
+}
+
+// writeFileAtomic writes to a temp file and renames it over fn, so a power cut
+// leaves either the old file or the new one, never half of one
+func writeFileAtomic(fn string, data []byte) error {
+	dir := filepath.Dir(fn)
+	f, err := os.CreateTemp(dir, filepath.Base(fn)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	err = errors.Join(err, f.Close())
+	if err == nil {
+		err = os.Chmod(tmp, 0666)
+	}
+	if err == nil {
+		err = os.Rename(tmp, fn)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	// make the rename itself stick
+	d, err := os.Open(dir)
+	if err != nil {
+		return nil
+	}
+	defer d.Close()
+	d.Sync()
+	return nil
+}
+
+// appendLine adds a line to the day's prefix file, these files are only ever appended to
+func (s *localJSONStore) appendLine(prefix string, now time.Time, line []byte) error {
+	s.appendLock.Lock()
+	defer s.appendLock.Unlock()
+
+	f, err := os.OpenFile(s.prefixFileName(prefix, now), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	if err == nil {
+		err = f.Sync()
+	}
+	return errors.Join(err, f.Close())
+}
+
+// readJSONLines reads the prefix files from through to, skipping lines it can't read
+func readJSONLines[T any](s *localJSONStore, prefix string, from, to time.Time) ([]T, error) {
+	res := []T{}
+	for d := startOfDay(from); !d.After(to); d = d.AddDate(0, 0, 1) {
+		fn := s.prefixFileName(prefix, d)
+		data, err := os.ReadFile(fn)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		x, err := jsonLinesIn[T](string(data))
+		if err != nil {
+			s.logger.Warnf("skipping bad lines in %v: %v", fn, err)
+		}
+		res = append(res, x...)
+	}
+	return res, nil
+}
+
+// jsonLinesIn returns every line it could read, and an error about the ones it couldn't
+func jsonLinesIn[T any](raw string) ([]T, error) {
+	res := []T{}
+	var errs []error
+
+	for _, l := range strings.Split(raw, "\n") {
+		l = strings.TrimSpace(l)
+		if len(l) == 0 {
+			continue
+		}
+		var x T
+		err := json.Unmarshal([]byte(l), &x)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid line [%s]", l))
+			continue
+		}
+		res = append(res, x)
+	}
+	return res, errors.Join(errs...)
+}
+
+func repairJSONLines(raw string) (string, error) {
+	var buffer bytes.Buffer
+	var errs []error
+
+	for _, l := range strings.Split(raw, "\n") {
+		l = strings.TrimSpace(l)
+		if len(l) == 0 {
+			continue
+		}
+		if !json.Valid([]byte(l)) {
+			errs = append(errs, fmt.Errorf("invalid line [%s]", l))
+			continue
+		}
+		buffer.WriteString(l)
+		buffer.WriteString("\n")
+	}
+	return buffer.String(), errors.Join(errs...)
 }
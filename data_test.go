@@ -2,9 +2,12 @@ package sprinkler
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"go.viam.com/rdk/logging"
+
 	"go.viam.com/test"
 )
 
@@ -25,7 +28,7 @@ func TestLocalJSONStore(t *testing.T) {
 	test.That(t, err, test.ShouldBeNil)
 	defer os.RemoveAll(dir)
 
-	s, err := NewLocalJSONStore(dir)
+	s, err := NewLocalJSONStore(dir, logging.NewTestLogger(t))
 	test.That(t, err, test.ShouldBeNil)
 
 	now := time.Now()
@@ -47,7 +50,7 @@ func TestLocalJSONStore(t *testing.T) {
 	test.That(t, d, test.ShouldEqual, 2*time.Minute)
 
 	// test opening new store
-	s2, err := NewLocalJSONStore(dir)
+	s2, err := NewLocalJSONStore(dir, logging.NewTestLogger(t))
 	test.That(t, err, test.ShouldBeNil)
 
 	d, err = s2.AmountWatered("a", now)
@@ -71,7 +74,7 @@ func BenchmarkJSONStore(b *testing.B) {
 	}
 	defer os.RemoveAll(dir)
 
-	s, err := NewLocalJSONStore(dir)
+	s, err := NewLocalJSONStore(dir, logging.NewTestLogger(b))
 	if err != nil {
 		b.Fatal(err)
 	}
@@ -85,3 +88,206 @@ func BenchmarkJSONStore(b *testing.B) {
 		}
 	}
 }
+
+func TestLocalJSONStoreVolume(t *testing.T) {
+	s, err := NewLocalJSONStore(t.TempDir(), logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+
+	// a wednesday
+	now := time.Date(2026, time.June, 17, 10, 0, 0, 0, time.UTC)
+
+	v, err := s.AddVolume("a", now, 10.5)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, v, test.ShouldEqual, 10.5)
+
+	v, err = s.AddVolume("a", now, 2)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, v, test.ShouldEqual, 12.5)
+
+	_, err = s.AddVolume("a", now.AddDate(0, 0, -2), 100)
+	test.That(t, err, test.ShouldBeNil)
+	_, err = s.AddVolume("a", now.AddDate(0, 0, -3), 1000)
+	test.That(t, err, test.ShouldBeNil)
+
+	v, err = s.VolumeUsed("a", now, now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, v, test.ShouldEqual, 12.5)
+
+	v, err = s.VolumeUsed("a", startOfWeek(now), now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, v, test.ShouldEqual, 112.5)
+
+	v, err = s.VolumeUsed("a", startOfMonth(now), now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, v, test.ShouldEqual, 1112.5)
+
+	v, err = s.VolumeUsed("b", startOfMonth(now), now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, v, test.ShouldEqual, 0)
+}
+
+func TestPeriodStarts(t *testing.T) {
+	wed := time.Date(2026, time.June, 17, 10, 0, 0, 0, time.UTC)
+	test.That(t, startOfDay(wed), test.ShouldEqual, time.Date(2026, time.June, 17, 0, 0, 0, 0, time.UTC))
+	test.That(t, startOfWeek(wed), test.ShouldEqual, time.Date(2026, time.June, 15, 0, 0, 0, 0, time.UTC))
+	test.That(t, startOfMonth(wed), test.ShouldEqual, time.Date(2026, time.June, 1, 0, 0, 0, 0, time.UTC))
+
+	sun := time.Date(2026, time.June, 21, 10, 0, 0, 0, time.UTC)
+	test.That(t, startOfWeek(sun), test.ShouldEqual, time.Date(2026, time.June, 15, 0, 0, 0, 0, time.UTC))
+}
+
+func TestLocalJSONStoreCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2025, 6, 3, 10, 0, 0, 0, time.Local)
+
+	s, err := NewLocalJSONStore(dir, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	fn := s.(*localJSONStore).fileName(now)
+
+	// a torn write in the middle of the file only loses that line
+	test.That(t, os.WriteFile(fn, []byte("a 2.0\nb 3.\x00\x00\nc 1.5\n"), 0666), test.ShouldBeNil)
+	d, err := s.AmountWatered("a", now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, d, test.ShouldEqual, 2*time.Minute)
+	d, err = s.AmountWatered("c", now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, d, test.ShouldEqual, 90*time.Second)
+
+	// leftovers from a write that never finished go away on open
+	test.That(t, os.WriteFile(fn+".tmp123", []byte("a 9"), 0666), test.ShouldBeNil)
+
+	s, err = NewLocalJSONStore(dir, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+
+	_, err = os.Stat(fn + ".tmp123")
+	test.That(t, os.IsNotExist(err), test.ShouldBeTrue)
+
+	q, err := os.ReadDir(filepath.Join(dir, "quarantine"))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(q), test.ShouldEqual, 1)
+
+	raw, err := os.ReadFile(fn)
+	test.That(t, err, test.ShouldBeNil)
+	_, err = dataIn(string(raw))
+	test.That(t, err, test.ShouldBeNil)
+
+	d, err = s.AmountWatered("c", now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, d, test.ShouldEqual, 90*time.Second)
+}
+
+// the json files are moved to quarantine and start over empty if they can't be read
+func TestCorruptJSONFiles(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		fn   func(root string) string
+		data string
+	}{
+		{"state", stateFileName, `{"PauseTill": "20`},
+		{"balance", waterBalanceFileName, "{\"Day\": \"2026-06-\x00\x00"},
+		{"flow baseline", flowBaselineFileName, `{"a": {"LitersPerMinute": "x"}}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			test.That(t, os.WriteFile(tc.fn(dir), []byte(tc.data), 0666), test.ShouldBeNil)
+
+			s := sprinkler{config: &sprinklerConfig{DataDir: dir}, logger: logging.NewTestLogger(t)}
+			test.That(t, s.init(), test.ShouldBeNil)
+			defer s.stats.Close()
+			test.That(t, s.pauseTillTime.IsZero(), test.ShouldBeTrue)
+			test.That(t, s.balance.Day, test.ShouldEqual, "")
+			test.That(t, s.balance.Depletion, test.ShouldBeEmpty)
+			test.That(t, s.flowBaseline, test.ShouldBeEmpty)
+
+			_, err := os.Stat(tc.fn(dir))
+			test.That(t, os.IsNotExist(err), test.ShouldBeTrue)
+			q, err := os.ReadDir(filepath.Join(dir, "quarantine"))
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, len(q), test.ShouldEqual, 1)
+		})
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "x.txt")
+
+	test.That(t, writeFileAtomic(fn, []byte("one")), test.ShouldBeNil)
+	test.That(t, writeFileAtomic(fn, []byte("two")), test.ShouldBeNil)
+
+	raw, err := os.ReadFile(fn)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, string(raw), test.ShouldEqual, "two")
+
+	entries, err := os.ReadDir(dir)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(entries), test.ShouldEqual, 1)
+}
+
+func TestLocalJSONStoreCache(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newLocalJSONStore(dir, time.Hour, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+
+	now := time.Now()
+	fn := s.fileName(now)
+
+	for i := 0; i < 6; i++ {
+		_, err = s.AddWatered("a", now, 10*time.Second)
+		test.That(t, err, test.ShouldBeNil)
+	}
+	_, err = s.AddVolume("a", now, 3)
+	test.That(t, err, test.ShouldBeNil)
+
+	// nothing written yet, but it reads back from memory
+	_, err = os.Stat(fn)
+	test.That(t, os.IsNotExist(err), test.ShouldBeTrue)
+	d, err := s.AmountWatered("a", now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, d, test.ShouldEqual, time.Minute)
+
+	test.That(t, s.Flush(), test.ShouldBeNil)
+	raw, err := os.ReadFile(fn)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, string(raw), test.ShouldEqual, "a 1.000000\n")
+
+	_, err = s.AddWatered("a", now, time.Minute)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, s.Close(), test.ShouldBeNil)
+
+	s2, err := NewLocalJSONStore(dir, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	d, err = s2.AmountWatered("a", now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, d, test.ShouldEqual, 2*time.Minute)
+	l, err := s2.VolumeUsed("a", now, now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, l, test.ShouldEqual, 3)
+}
+
+func TestLocalJSONStoreFlushInterval(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newLocalJSONStore(dir, 10*time.Millisecond, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	defer s.Close()
+
+	now := time.Now()
+	_, err = s.AddWatered("a", now, time.Minute)
+	test.That(t, err, test.ShouldBeNil)
+
+	// a crash now would only lose what's since the last tick
+	for i := 0; i < 100; i++ {
+		if _, err = os.Stat(s.fileName(now)); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	test.That(t, err, test.ShouldBeNil)
+}
+
+func TestLocalJSONStoreCachedAPI(t *testing.T) {
+	s, err := newLocalJSONStore(t.TempDir(), time.Hour, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	defer s.Close()
+	testStore(t, s)
+}
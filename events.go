@@ -0,0 +1,121 @@
+package sprinkler
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// why a valve opened or closed, or a zone's time changed
+const (
+	causeSchedule = "schedule" // the schedule picked it, or it was done
+	causeForce    = "force"    // someone ran or stopped it by hand
+	causeWeather  = "weather"  // rain or temperature changed how long it needs
+	causeMark     = "mark"     // someone marked time against it by hand
+	causePause    = "pause"    // paused, or a rain or freeze sensor stopped everything
+	causeFault    = "fault"    // max run, leak, or the watchdog
+	causeConfig   = "config"   // starting up, or the zone moved or went away
+	causeShutdown = "shutdown" // the module closed
+)
+
+// Event is one line in the event log. Weather and mark events don't move a
+// valve, Minutes is how much was added to the zone's time for the day.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Zone    string    `json:"zone"`
+	On      bool      `json:"on"`
+	Cause   string    `json:"cause"`
+	Detail  string    `json:"detail,omitempty"`
+	Minutes float64   `json:"minutes,omitempty"`
+}
+
+func (e Event) toMap() map[string]interface{} {
+	m := map[string]interface{}{
+		"time":  e.Time.Format(time.RFC3339),
+		"zone":  e.Zone,
+		"on":    e.On,
+		"cause": e.Cause,
+	}
+	if e.Detail != "" {
+		m["detail"] = e.Detail
+	}
+	if e.Minutes != 0 {
+		m["minutes"] = e.Minutes
+	}
+	return m
+}
+
+// why is what goes in the event log when stopAllExcept changes a valve
+type why struct {
+	at     time.Time // zero means now
+	cause  string
+	detail string
+	off    map[string]why // zones that went off for their own reason, like a fault
+}
+
+func (w why) forZone(zone string, on bool) why {
+	if o, ok := w.off[zone]; ok && !on {
+		return o
+	}
+	return w
+}
+
+// why_inlock fills in the zones that are off because they're faulted or held
+func (s *sprinkler) why_inlock(now time.Time, cause, detail string) why {
+	w := why{at: now, cause: cause, detail: detail, off: map[string]why{}}
+	for z, f := range s.faults {
+		w.off[z] = why{at: now, cause: causeFault, detail: f}
+	}
+	for z, t := range s.holdTill {
+		if now.Before(t) {
+			w.off[z] = why{at: now, cause: causeForce, detail: "stopped by hand"}
+		}
+	}
+	return w
+}
+
+// record writes to the event log, losing an event isn't worth stopping for
+func (s *sprinkler) record(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	err := s.stats.AddEvent(e)
+	if err != nil {
+		s.logger.Warnf("cannot write event log %v", err)
+	}
+}
+
+func (s *sprinkler) recordValve(zone string, on bool, w why) {
+	w = w.forZone(zone, on)
+	s.record(Event{Time: w.at, Zone: zone, On: on, Cause: w.cause, Detail: w.detail})
+
+	// the totals are worth saving whenever a valve changes
+	err := s.stats.Flush()
+	if err != nil {
+		s.logger.Warnf("cannot flush data %v", err)
+	}
+}
+
+// ----
+
+func (s *localJSONStore) AddEvent(e Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.appendLine("events", e.Time, line)
+}
+
+func (s *localJSONStore) Events(from, to time.Time) ([]Event, error) {
+	all, err := readJSONLines[Event](s, "events", from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []Event{}
+	for _, e := range all {
+		if !e.Time.Before(from) && !e.Time.After(to) {
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
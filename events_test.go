@@ -0,0 +1,136 @@
+package sprinkler
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/logging"
+
+	"go.viam.com/test"
+)
+
+func TestEventLog(t *testing.T) {
+	ctx := context.Background()
+	s := sprinkler{config: &testSimpleConfig, logger: logging.NewTestLogger(t)}
+	f := addDummyPins(&s)
+	defer f()
+
+	now := time.Now()
+	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+
+	_, err := s.DoCommand(ctx, map[string]interface{}{"cmd": "run", "zone": "a", "minutes": 5.0})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, s.doLoop(ctx, now.Add(time.Minute)), test.ShouldBeNil)
+
+	_, err = s.DoCommand(ctx, map[string]interface{}{"cmd": "markZoneTime", "zone": "c", "minutes": 2.0})
+	test.That(t, err, test.ShouldBeNil)
+	// one that's rejected doesn't make it into the log
+	_, err = s.DoCommand(ctx, map[string]interface{}{"cmd": "markZoneTime", "zone": "c", "minutes": -2.0})
+	test.That(t, err, test.ShouldNotBeNil)
+
+	_, err = s.DoCommand(ctx, map[string]interface{}{"cmd": "stop", "zone": "a"})
+	test.That(t, err, test.ShouldBeNil)
+	_, err = s.DoCommand(ctx, map[string]interface{}{"cmd": "pause", "minutes": 60.0})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, s.doLoop(ctx, now.Add(2*time.Minute)), test.ShouldBeNil)
+
+	events, err := s.stats.Events(startOfDay(now), now.Add(time.Hour))
+	test.That(t, err, test.ShouldBeNil)
+
+	type got struct {
+		zone  string
+		on    bool
+		cause string
+	}
+	all := []got{}
+	for _, e := range events {
+		all = append(all, got{e.Zone, e.On, e.Cause})
+	}
+	test.That(t, len(all), test.ShouldEqual, 5)
+	test.That(t, all[0], test.ShouldResemble, got{"b", true, causeSchedule})
+	// the valves in one change can go in any order
+	test.That(t, all[1:3], test.ShouldContain, got{"b", false, causeForce})
+	test.That(t, all[1:3], test.ShouldContain, got{"a", true, causeForce})
+	test.That(t, all[3:], test.ShouldResemble, []got{
+		{"c", false, causeMark},
+		{"a", false, causeForce}, // stopped by hand wins over the pause
+	})
+	test.That(t, events[3].Minutes, test.ShouldEqual, 2.0)
+	test.That(t, events[4].Detail, test.ShouldEqual, "stopped by hand")
+
+	res, err := s.DoCommand(ctx, map[string]interface{}{
+		"cmd":  "history",
+		"zone": "b",
+		"from": startOfDay(now).Format(time.RFC3339),
+		"to":   now.Add(time.Hour).Format(time.RFC3339),
+	})
+	test.That(t, err, test.ShouldBeNil)
+	b := res["events"].([]interface{})
+	test.That(t, len(b), test.ShouldEqual, 2)
+	test.That(t, b[0].(map[string]interface{})["cause"], test.ShouldEqual, causeSchedule)
+
+	// nothing before it started
+	res, err = s.DoCommand(ctx, map[string]interface{}{
+		"cmd": "history",
+		"to":  now.Add(-time.Hour).Format(time.RFC3339),
+	})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["events"], test.ShouldBeEmpty)
+
+	_, err = s.DoCommand(ctx, map[string]interface{}{"cmd": "history", "from": "yesterday"})
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestEventLogTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewLocalJSONStore(dir, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+
+	now := time.Now()
+	test.That(t, s.AddEvent(Event{Time: now, Zone: "a", On: true, Cause: causeSchedule}), test.ShouldBeNil)
+
+	// power went out half way through the next one
+	fn := s.(*localJSONStore).prefixFileName("events", now)
+	f, err := os.OpenFile(fn, os.O_APPEND|os.O_WRONLY, 0666)
+	test.That(t, err, test.ShouldBeNil)
+	_, err = f.WriteString(`{"time":"`)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, f.Close(), test.ShouldBeNil)
+
+	events, err := s.Events(now.Add(-time.Minute), now.Add(time.Minute))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(events), test.ShouldEqual, 1)
+
+	// reopening repairs it, so new events don't land on the end of the bad line
+	s, err = NewLocalJSONStore(dir, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, s.AddEvent(Event{Time: now, Zone: "a", Cause: causeSchedule}), test.ShouldBeNil)
+
+	events, err = s.Events(now.Add(-time.Minute), now.Add(time.Minute))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(events), test.ShouldEqual, 2)
+}
+
+func TestFlushOnValveChange(t *testing.T) {
+	ctx := context.Background()
+	s := sprinkler{config: &sprinklerConfig{StartHour: -1, FlushSeconds: 3600, Zones: testSimpleConfig.Zones}, logger: logging.NewTestLogger(t)}
+	f := addDummyPins(&s)
+	defer f()
+
+	now := time.Now()
+	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+	test.That(t, s.doLoop(ctx, now.Add(time.Minute)), test.ShouldBeNil)
+
+	fn := s.stats.(*localJSONStore).fileName(now)
+	_, err := os.Stat(fn)
+	test.That(t, os.IsNotExist(err), test.ShouldBeTrue)
+
+	// turning b off writes out its minute
+	s.pauseTillTime = now.Add(time.Hour)
+	test.That(t, s.doLoop(ctx, now.Add(2*time.Minute)), test.ShouldBeNil)
+	raw, err := os.ReadFile(fn)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, string(raw), test.ShouldEqual, "b 2.000000\n")
+}
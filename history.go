@@ -0,0 +1,233 @@
+package sprinkler
+
+import (
+	"fmt"
+	"time"
+)
+
+// maxHistoryDays is the longest range history reads in one go, it's on the web server with no login
+const maxHistoryDays = 366
+
+// DayTotal is what a zone got over a day, or a week or month in a rollup
+type DayTotal struct {
+	Day     time.Time // start of the day, week or month
+	Minutes float64   // time the valve was really open
+	Rain    float64   // minutes credited for rain
+	Heat    float64   // minutes added for heat
+	Cold    float64   // minutes credited for cold
+	Marked  float64   // minutes marked done by hand
+	Liters  float64
+}
+
+func (d DayTotal) add(o DayTotal) DayTotal {
+	d.Minutes += o.Minutes
+	d.Rain += o.Rain
+	d.Heat += o.Heat
+	d.Cold += o.Cold
+	d.Marked += o.Marked
+	d.Liters += o.Liters
+	return d
+}
+
+func (d DayTotal) toMap() map[string]interface{} {
+	return map[string]interface{}{
+		"day":     dayString(d.Day),
+		"minutes": d.Minutes,
+		"rain":    d.Rain,
+		"heat":    d.Heat,
+		"cold":    d.Cold,
+		"marked":  d.Marked,
+		"liters":  d.Liters,
+	}
+}
+
+// rollup adds up days into the periods start puts them in, ex: startOfWeek.
+// Periods at the ends of the range only have the days that are in it.
+func rollup(days []DayTotal, start func(time.Time) time.Time) []DayTotal {
+	res := []DayTotal{}
+	for _, d := range days {
+		p := start(d.Day)
+		if len(res) == 0 || !res[len(res)-1].Day.Equal(p) {
+			res = append(res, DayTotal{Day: p})
+		}
+		res[len(res)-1] = res[len(res)-1].add(d)
+	}
+	return res
+}
+
+func totalsToList(totals []DayTotal) []interface{} {
+	res := []interface{}{}
+	for _, t := range totals {
+		res = append(res, t.toMap())
+	}
+	return res
+}
+
+// history is the "history" do command: events and per day, week and month
+// totals from from to to, default today, for zone or every zone
+func (s *sprinkler) history(cmd map[string]interface{}) (map[string]interface{}, error) {
+	now := time.Now()
+	from, err := timeParam(cmd, "from", startOfDay(now), false)
+	if err != nil {
+		return nil, err
+	}
+	to, err := timeParam(cmd, "to", now, true)
+	if err != nil {
+		return nil, err
+	}
+	if to.Before(from) {
+		return nil, fmt.Errorf("to (%v) is before from (%v)", to, from)
+	}
+	if to.Sub(from) > maxHistoryDays*24*time.Hour {
+		return nil, fmt.Errorf("history can be at most %d days at a time", maxHistoryDays)
+	}
+	zone, _ := cmd["zone"].(string)
+
+	// the stores lock themselves, so don't hold up the loop while reading them
+	s.statsLock.Lock()
+	zones := s.config.zoneOrder()
+	_, ok := s.config.Zones[zone]
+	stats := s.stats
+	s.statsLock.Unlock()
+
+	if zone != "" {
+		if !ok {
+			return nil, fmt.Errorf("no zone [%s]", zone)
+		}
+		zones = []string{zone}
+	}
+
+	totals := map[string]interface{}{}
+	for _, z := range zones {
+		days, err := stats.History(z, from, to)
+		if err != nil {
+			return nil, err
+		}
+		totals[z] = map[string]interface{}{
+			"days":   totalsToList(days),
+			"weeks":  totalsToList(rollup(days, startOfWeek)),
+			"months": totalsToList(rollup(days, startOfMonth)),
+		}
+	}
+
+	events, err := stats.Events(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []interface{}{}
+	for _, e := range events {
+		if zone != "" && e.Zone != zone {
+			continue
+		}
+		res = append(res, e.toMap())
+	}
+	return map[string]interface{}{"events": res, "totals": totals}, nil
+}
+
+// timeParam reads an RFC3339 time or a plain date, which is the end of
+// that day if endOfDay is set
+func timeParam(cmd map[string]interface{}, name string, def time.Time, endOfDay bool) (time.Time, error) {
+	v, ok := cmd[name]
+	if !ok || v == "" {
+		return def, nil
+	}
+	str, ok := v.(string)
+	if !ok {
+		return time.Time{}, fmt.Errorf("%s has to be an RFC3339 time or a date string, got [%v] an %T", name, v, v)
+	}
+
+	t, err := time.Parse(time.RFC3339, str)
+	if err == nil {
+		return t, nil
+	}
+
+	t, err = time.ParseInLocation(time.DateOnly, str, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad %s time [%s], has to be RFC3339 or 2006-01-02", name, str)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
+
+// ----
+
+func (s *localJSONStore) History(z string, from, to time.Time) ([]DayTotal, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	res := []DayTotal{}
+	for d := startOfDay(from); !d.After(to); d = d.AddDate(0, 0, 1) {
+		ran, err := s.readFromDisk("data", d)
+		if err != nil {
+			return nil, err
+		}
+		adj, err := s.readFromDisk("adjust", d)
+		if err != nil {
+			return nil, err
+		}
+		vol, err := s.readVolumeFromDisk(d)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, DayTotal{
+			Day:     d,
+			Minutes: ran[z].Minutes(),
+			Rain:    adj[adjustmentKey(z, adjustRain)].Minutes(),
+			Heat:    adj[adjustmentKey(z, adjustHeat)].Minutes(),
+			Cold:    adj[adjustmentKey(z, adjustCold)].Minutes(),
+			Marked:  adj[adjustmentKey(z, adjustMark)].Minutes(),
+			Liters:  vol[z],
+		})
+	}
+	return res, nil
+}
+
+func (s *sqliteStore) History(z string, from, to time.Time) ([]DayTotal, error) {
+	rows, err := s.db.Query("SELECT day, kind, amount FROM totals WHERE zone = ? AND day >= ? AND day <= ?",
+		z, dayString(from), dayString(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byDay := map[string]*DayTotal{}
+	res := []DayTotal{}
+	for d := startOfDay(from); !d.After(to); d = d.AddDate(0, 0, 1) {
+		res = append(res, DayTotal{Day: d})
+	}
+	for i := range res {
+		byDay[dayString(res[i].Day)] = &res[i]
+	}
+
+	for rows.Next() {
+		var day, kind string
+		var amount float64
+		err = rows.Scan(&day, &kind, &amount)
+		if err != nil {
+			return nil, err
+		}
+		t, ok := byDay[day]
+		if !ok {
+			continue
+		}
+		switch kind {
+		case totalWatered:
+			t.Minutes = amount
+		case totalVolume:
+			t.Liters = amount
+		case "adjust:" + adjustRain:
+			t.Rain = amount
+		case "adjust:" + adjustHeat:
+			t.Heat = amount
+		case "adjust:" + adjustCold:
+			t.Cold = amount
+		case "adjust:" + adjustMark:
+			t.Marked = amount
+		}
+	}
+	return res, rows.Err()
+}
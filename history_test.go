@@ -0,0 +1,100 @@
+package sprinkler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/logging"
+
+	"go.viam.com/test"
+)
+
+func TestRollup(t *testing.T) {
+	// a sunday, then monday the 2nd through saturday the 7th
+	start := time.Date(2025, 6, 1, 0, 0, 0, 0, time.Local)
+	days := []DayTotal{}
+	for i := 0; i < 7; i++ {
+		days = append(days, DayTotal{Day: start.AddDate(0, 0, i), Minutes: 10, Liters: 1})
+	}
+
+	weeks := rollup(days, startOfWeek)
+	test.That(t, len(weeks), test.ShouldEqual, 2)
+	test.That(t, weeks[0], test.ShouldResemble, DayTotal{Day: start.AddDate(0, 0, -6), Minutes: 10, Liters: 1})
+	test.That(t, weeks[1], test.ShouldResemble, DayTotal{Day: start.AddDate(0, 0, 1), Minutes: 60, Liters: 6})
+
+	months := rollup(days, startOfMonth)
+	test.That(t, months, test.ShouldResemble, []DayTotal{{Day: start, Minutes: 70, Liters: 7}})
+
+	test.That(t, rollup(nil, startOfMonth), test.ShouldBeEmpty)
+}
+
+func TestHistory(t *testing.T) {
+	ctx := context.Background()
+	s := sprinkler{config: &testSimpleConfig, logger: logging.NewTestLogger(t)}
+	f := addDummyPins(&s)
+	defer f()
+
+	// the end of may into june
+	start := time.Date(2025, 5, 30, 8, 0, 0, 0, time.Local)
+	for i := 0; i < 5; i++ {
+		_, err := s.stats.AddWatered("a", start.AddDate(0, 0, i), time.Duration(i+1)*time.Minute)
+		test.That(t, err, test.ShouldBeNil)
+	}
+	_, err := s.stats.AddAdjustment("a", adjustRain, start, 2*time.Minute)
+	test.That(t, err, test.ShouldBeNil)
+
+	res, err := s.DoCommand(ctx, map[string]interface{}{"cmd": "history", "zone": "a", "from": "2025-05-30", "to": "2025-06-03"})
+	test.That(t, err, test.ShouldBeNil)
+	a := res["totals"].(map[string]interface{})["a"].(map[string]interface{})
+
+	days := a["days"].([]interface{})
+	test.That(t, len(days), test.ShouldEqual, 5)
+	test.That(t, days[0].(map[string]interface{})["day"], test.ShouldEqual, "2025-05-30")
+	test.That(t, days[0].(map[string]interface{})["rain"], test.ShouldEqual, 2.0)
+	test.That(t, days[4].(map[string]interface{})["minutes"], test.ShouldEqual, 5.0)
+
+	months := a["months"].([]interface{})
+	test.That(t, len(months), test.ShouldEqual, 2)
+	test.That(t, months[0].(map[string]interface{})["minutes"], test.ShouldEqual, 3.0)
+	test.That(t, months[1].(map[string]interface{})["minutes"], test.ShouldEqual, 12.0)
+
+	// friday the 30th to sunday the 1st, then monday on
+	weeks := a["weeks"].([]interface{})
+	test.That(t, len(weeks), test.ShouldEqual, 2)
+	test.That(t, weeks[1].(map[string]interface{})["day"], test.ShouldEqual, "2025-06-02")
+
+	// every zone without one
+	res, err = s.DoCommand(ctx, map[string]interface{}{"cmd": "history", "from": "2025-05-30", "to": "2025-05-30"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(res["totals"].(map[string]interface{})), test.ShouldEqual, 3)
+
+	_, err = s.DoCommand(ctx, map[string]interface{}{"cmd": "history", "zone": "nope"})
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = s.DoCommand(ctx, map[string]interface{}{"cmd": "history", "from": "2025-06-03", "to": "2025-05-30"})
+	test.That(t, err, test.ShouldNotBeNil)
+
+	// a whole leap year is fine, more than that isn't
+	_, err = s.DoCommand(ctx, map[string]interface{}{"cmd": "history", "from": "2024-01-01", "to": "2024-12-31"})
+	test.That(t, err, test.ShouldBeNil)
+	_, err = s.DoCommand(ctx, map[string]interface{}{"cmd": "history", "from": "2000-01-01", "to": "2025-06-03"})
+	test.That(t, err, test.ShouldNotBeNil)
+
+	// and the same over http
+	srv := newWebServer(":0", s.logger, &s)
+	w := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(w, httptest.NewRequest("GET", "/history?zone=a&from=2025-06-01&to=2025-06-02", nil))
+	test.That(t, w.Code, test.ShouldEqual, 200)
+
+	got := map[string]interface{}{}
+	test.That(t, json.Unmarshal(w.Body.Bytes(), &got), test.ShouldBeNil)
+	days = got["totals"].(map[string]interface{})["a"].(map[string]interface{})["days"].([]interface{})
+	test.That(t, len(days), test.ShouldEqual, 2)
+	test.That(t, days[1].(map[string]interface{})["minutes"], test.ShouldEqual, 4.0)
+
+	w = httptest.NewRecorder()
+	srv.Handler.ServeHTTP(w, httptest.NewRequest("GET", "/history?from=junk", nil))
+	test.That(t, w.Code, test.ShouldEqual, 400)
+}
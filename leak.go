@@ -0,0 +1,142 @@
+package sprinkler
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.viam.com/rdk/logging"
+)
+
+const (
+	// DefaultLeakFactor is how far above normal flow has to be before we call it a leak
+	DefaultLeakFactor = 1.5
+
+	// DefaultIdleFlowLitersPerMinute is how much flow we ignore when nothing is running
+	DefaultIdleFlowLitersPerMinute = 0.5
+
+	// how many readings we need before we trust a baseline
+	flowBaselineMinSamples = 10
+
+	// how much each new reading moves the baseline
+	flowBaselineWeight = 0.1
+)
+
+type zoneFlow struct {
+	LitersPerMinute float64
+	Samples         int
+}
+
+// flowBaseline is the flow each zone normally has, learned while it runs
+type flowBaseline map[string]zoneFlow
+
+func flowBaselineFileName(root string) string {
+	return filepath.Join(root, "flow_baseline.json")
+}
+
+func loadFlowBaseline(root string, logger logging.Logger) (flowBaseline, error) {
+	fb, _, err := loadJSONFile[flowBaseline](root, flowBaselineFileName(root), logger)
+	if err != nil {
+		return nil, err
+	}
+	if fb == nil {
+		fb = flowBaseline{}
+	}
+	return fb, nil
+}
+
+func (fb flowBaseline) save(root string) error {
+	data, err := json.MarshalIndent(fb, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(flowBaselineFileName(root), data)
+}
+
+func (fb flowBaseline) learn(zone string, litersPerMinute float64) {
+	f := fb[zone]
+	if f.Samples == 0 {
+		f.LitersPerMinute = litersPerMinute
+	} else {
+		f.LitersPerMinute += flowBaselineWeight * (litersPerMinute - f.LitersPerMinute)
+	}
+	f.Samples++
+	fb[zone] = f
+}
+
+// expected is the total normal flow for the zones, false if we don't know yet
+func (fb flowBaseline) expected(zones []string) (float64, bool) {
+	total := 0.0
+	for _, z := range zones {
+		f := fb[z]
+		if f.Samples < flowBaselineMinSamples {
+			return 0, false
+		}
+		total += f.LitersPerMinute
+	}
+	return total, true
+}
+
+// checkFlow_inlock looks at the flow since the last reading for leaks and stuck valves
+func (s *sprinkler) checkFlow_inlock(litersPerMinute float64, since, now time.Time) error {
+	for _, z := range s.running {
+		if s.runningSince[z].After(since) {
+			// the zone wasn't on the whole time, so the reading doesn't mean much
+			return nil
+		}
+	}
+
+	if len(s.running) == 0 {
+		if litersPerMinute > s.config.idleFlow() {
+			s.raiseAlert_inlock(now, fmt.Sprintf("%0.1f liters/minute flowing with no zone on, stuck valve or leak", litersPerMinute))
+		}
+		return nil
+	}
+
+	expected, ok := s.flowBaseline.expected(s.running)
+	if ok && litersPerMinute > expected*s.config.leakFactor() {
+		names := strings.Join(s.running, ", ")
+		s.raiseAlert_inlock(now, fmt.Sprintf("%s using %0.1f liters/minute, normally %0.1f, broken head or pipe", names, litersPerMinute, expected))
+		if s.config.LeakShutoff {
+			for _, z := range s.running {
+				s.faults[z] = fmt.Sprintf("flow %0.1f liters/minute, normally %0.1f", litersPerMinute, expected)
+			}
+			return s.saveState_inlock()
+		}
+		return nil
+	}
+
+	// zones running together each learn their share, so zones that never run alone still get a baseline
+	shares, ok := s.config.flowShares(s.running)
+	if !ok && len(s.running) > 1 {
+		return nil
+	}
+	for z, share := range shares {
+		s.flowBaseline.learn(z, litersPerMinute*share)
+	}
+	s.flowBaselineDirty = true
+	return s.saveFlowBaseline_inlock(now, false)
+}
+
+// saveFlowBaseline_inlock writes the baseline out if it changed, no more than every flush_seconds unless force
+func (s *sprinkler) saveFlowBaseline_inlock(now time.Time, force bool) error {
+	if !s.flowBaselineDirty {
+		return nil
+	}
+	if !force && now.Sub(s.flowBaselineSaved) < s.config.flushInterval() {
+		return nil
+	}
+	err := s.flowBaseline.save(s.config.DataDir)
+	if err != nil {
+		return err
+	}
+	s.flowBaselineDirty, s.flowBaselineSaved = false, now
+	return nil
+}
+
+func (s *sprinkler) raiseAlert_inlock(now time.Time, msg string) {
+	s.logger.Warnf("alert: %s", msg)
+	s.alert = fmt.Sprintf("%s: %s", now.Format(time.UnixDate), msg)
+}
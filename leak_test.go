@@ -0,0 +1,155 @@
+package sprinkler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/board"
+	"go.viam.com/rdk/components/board/fake"
+	"go.viam.com/rdk/logging"
+
+	"go.viam.com/test"
+)
+
+func TestFlowBaseline(t *testing.T) {
+	fb := flowBaseline{}
+
+	_, ok := fb.expected([]string{"a"})
+	test.That(t, ok, test.ShouldBeFalse)
+
+	for i := 0; i < flowBaselineMinSamples; i++ {
+		fb.learn("a", 10)
+	}
+	x, ok := fb.expected([]string{"a"})
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, x, test.ShouldEqual, 10)
+
+	// one odd reading only moves it a little
+	fb.learn("a", 20)
+	x, _ = fb.expected([]string{"a"})
+	test.That(t, x, test.ShouldAlmostEqual, 11)
+
+	// we can't say what two zones should do together if we don't know one of them
+	_, ok = fb.expected([]string{"a", "b"})
+	test.That(t, ok, test.ShouldBeFalse)
+}
+
+func TestLeak(t *testing.T) {
+	ctx := context.Background()
+	s := sprinkler{
+		config: &sprinklerConfig{
+			StartHour:               -1,
+			FlowMeterPulsesPerLiter: 0.1,
+			LeakShutoff:             true,
+			Zones: map[string]ZoneConfig{
+				"lawn": {Minutes: 100},
+				"beds": {Minutes: 50},
+			},
+		},
+		logger: logging.NewTestLogger(t),
+	}
+	f := addDummyPins(&s)
+	defer f()
+
+	// on the fake board, pin 0 pulses once every time it's read, so 10 liters a read
+	meter, err := fake.NewDigitalInterrupt(board.DigitalInterruptConfig{Name: "meter", Pin: "0"})
+	test.That(t, err, test.ShouldBeNil)
+	s.flowMeter = meter
+
+	now := time.Now()
+	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldResemble, []string{"lawn"})
+
+	// learn that the lawn normally does 10 liters a minute
+	for i := 1; i <= flowBaselineMinSamples; i++ {
+		now = now.Add(time.Minute)
+		test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+	}
+	test.That(t, s.flowBaseline["lawn"].LitersPerMinute, test.ShouldAlmostEqual, 10)
+	test.That(t, s.alert, test.ShouldEqual, "")
+
+	// the same 10 liters in half the time is a broken head
+	now = now.Add(30 * time.Second)
+	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+	test.That(t, s.alert, test.ShouldNotEqual, "")
+	test.That(t, s.faults["lawn"], test.ShouldNotEqual, "")
+	test.That(t, s.running, test.ShouldResemble, []string{"beds"})
+
+	// the leak didn't get learned, and the baseline survives a restart
+	fb, err := loadFlowBaseline(s.config.DataDir, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, fb["lawn"].LitersPerMinute, test.ShouldAlmostEqual, 10)
+
+	readings, err := s.Readings(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, readings["lawn-fault"], test.ShouldNotEqual, "")
+	test.That(t, readings["beds-fault"], test.ShouldEqual, "")
+	test.That(t, readings["alert"], test.ShouldEqual, s.alert)
+
+	_, err = s.DoCommand(ctx, map[string]interface{}{"cmd": "run", "zone": "lawn", "minutes": 1.0})
+	test.That(t, err, test.ShouldNotBeNil)
+
+	// dismissing the alert doesn't clear the fault
+	_, err = s.DoCommand(ctx, map[string]interface{}{"cmd": "clearAlert"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, s.alert, test.ShouldEqual, "")
+	test.That(t, s.faults["lawn"], test.ShouldNotEqual, "")
+
+	_, err = s.DoCommand(ctx, map[string]interface{}{"cmd": "clearFault"})
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, s.faults["lawn"], test.ShouldNotEqual, "")
+
+	_, err = s.DoCommand(ctx, map[string]interface{}{"cmd": "clearFault", "zone": "lawn"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, s.faults, test.ShouldBeEmpty)
+
+	// water running with every zone off
+	s.pauseTillTime = now.Add(time.Hour)
+	now = now.Add(time.Minute)
+	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldBeEmpty)
+	test.That(t, s.alert, test.ShouldEqual, "")
+	now = now.Add(time.Minute)
+	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+	test.That(t, s.alert, test.ShouldContainSubstring, "no zone on")
+}
+
+func TestFlowBaselineShared(t *testing.T) {
+	now := time.Now()
+	s := sprinkler{
+		config: &sprinklerConfig{
+			DataDir: t.TempDir(),
+			MaxFlow: 10,
+			Zones: map[string]ZoneConfig{
+				"spray": {Flow: 3},
+				"drip":  {Flow: 1},
+			},
+		},
+		logger:       logging.NewTestLogger(t),
+		flowBaseline: flowBaseline{},
+		running:      []string{"spray", "drip"},
+		runningSince: map[string]time.Time{"spray": now.Add(-time.Hour), "drip": now.Add(-time.Hour)},
+	}
+
+	// the drip zone never runs alone, it still learns its share
+	for i := 0; i < flowBaselineMinSamples; i++ {
+		test.That(t, s.checkFlow_inlock(20, now.Add(-time.Minute), now), test.ShouldBeNil)
+	}
+	test.That(t, s.flowBaseline["spray"].LitersPerMinute, test.ShouldAlmostEqual, 15)
+	test.That(t, s.flowBaseline["drip"].LitersPerMinute, test.ShouldAlmostEqual, 5)
+
+	x, ok := s.flowBaseline.expected([]string{"drip"})
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, x, test.ShouldAlmostEqual, 5)
+}
+
+func TestLeakValidate(t *testing.T) {
+	cfg := sprinklerConfig{Board: "b", LeakFactor: 0.5}
+	_, _, err := cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	cfg.LeakFactor = 2
+	_, _, err = cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+}
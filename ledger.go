@@ -0,0 +1,54 @@
+package sprinkler
+
+import (
+	"time"
+)
+
+// kinds of adjustment, they're all kept as positive minutes
+const (
+	adjustRain = "rain" // less to do, it rained or will
+	adjustHeat = "heat" // more to do, it's hot
+	adjustCold = "cold" // less to do, it's cold
+	adjustMark = "mark" // less to do, someone said it's done
+)
+
+// ledger is a zone's day: how long it really ran, and what it's been credited
+type ledger struct {
+	Ran  time.Duration
+	Rain time.Duration
+	Heat time.Duration
+	Cold time.Duration
+	Mark time.Duration
+}
+
+// credit is how much less than configured the zone needs today, heat makes it negative
+func (l ledger) credit() time.Duration {
+	return l.Rain + l.Cold + l.Mark - l.Heat
+}
+
+func (s *sprinkler) ledger_inlock(zone string, now time.Time) (ledger, error) {
+	ran, err := s.stats.AmountWatered(zone, now)
+	if err != nil {
+		return ledger{}, err
+	}
+
+	adj, err := s.stats.Adjustments(zone, now)
+	if err != nil {
+		return ledger{}, err
+	}
+
+	return ledger{
+		Ran:  ran,
+		Rain: adj[adjustRain],
+		Heat: adj[adjustHeat],
+		Cold: adj[adjustCold],
+		Mark: adj[adjustMark],
+	}, nil
+}
+
+// effectiveTarget_inlock is the minutes configured (or from the water balance) less credits,
+// never more than the hottest day could ask for, however the credits got there
+func (s *sprinkler) effectiveTarget_inlock(zone string, now time.Time, l ledger) float64 {
+	target := s.targetMinutes_inlock(zone, now)
+	return min(target-l.credit().Minutes(), target*(1+maxHeatExtra))
+}
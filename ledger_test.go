@@ -0,0 +1,74 @@
+package sprinkler
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/logging"
+
+	"go.viam.com/test"
+)
+
+func TestLedger(t *testing.T) {
+	ctx := context.Background()
+	s := sprinkler{config: &testSimpleConfig, logger: logging.NewTestLogger(t)}
+	f := addDummyPins(&s)
+	defer f()
+
+	now := time.Now()
+	_, err := s.stats.AddAdjustment("b", adjustRain, now, 5*time.Minute)
+	test.That(t, err, test.ShouldBeNil)
+	_, err = s.stats.AddAdjustment("b", adjustHeat, now, 2*time.Minute)
+	test.That(t, err, test.ShouldBeNil)
+
+	_, err = s.DoCommand(ctx, map[string]interface{}{"cmd": "markZoneTime", "zone": "b", "minutes": 3.0})
+	test.That(t, err, test.ShouldBeNil)
+
+	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+	test.That(t, s.doLoop(ctx, now.Add(time.Minute)), test.ShouldBeNil)
+
+	l, err := s.ledger_inlock("b", now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, l, test.ShouldResemble, ledger{Ran: time.Minute, Rain: 5 * time.Minute, Heat: 2 * time.Minute, Mark: 3 * time.Minute})
+	test.That(t, s.effectiveTarget_inlock("b", now, l), test.ShouldEqual, 14)
+
+	r, err := s.Readings(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, r["b"], test.ShouldEqual, 1.0)
+	test.That(t, r["b-rain-minutes"], test.ShouldEqual, 5.0)
+	test.That(t, r["b-heat-minutes"], test.ShouldEqual, 2.0)
+	test.That(t, r["b-cold-minutes"], test.ShouldEqual, 0.0)
+	test.That(t, r["b-marked-minutes"], test.ShouldEqual, 3.0)
+	test.That(t, r["b-target"], test.ShouldEqual, 14.0)
+	test.That(t, r["b-configured"], test.ShouldEqual, 20)
+
+	// once the credits cover it, it's done without running
+	_, err = s.stats.AddAdjustment("b", adjustCold, now, 14*time.Minute)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, s.needsWater_inlock("b", now), test.ShouldBeFalse)
+}
+
+func TestLedgerLimits(t *testing.T) {
+	ctx := context.Background()
+	s := sprinkler{config: &testSimpleConfig, logger: logging.NewTestLogger(t)}
+	f := addDummyPins(&s)
+	defer f()
+
+	now := time.Now()
+	for _, m := range []float64{-5, math.NaN(), math.Inf(1)} {
+		_, err := s.DoCommand(ctx, map[string]interface{}{"cmd": "markZoneTime", "zone": "b", "minutes": m})
+		test.That(t, err, test.ShouldNotBeNil)
+	}
+	l, err := s.ledger_inlock("b", now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, l.Mark, test.ShouldEqual, 0)
+
+	// however the credits got there, the target can't run away
+	_, err = s.stats.AddAdjustment("b", adjustHeat, now, 1000*time.Minute)
+	test.That(t, err, test.ShouldBeNil)
+	l, err = s.ledger_inlock("b", now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, s.effectiveTarget_inlock("b", now, l), test.ShouldEqual, 60)
+}
@@ -3,6 +3,7 @@ package sprinkler
 import (
 	"context"
 	_ "embed"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"net/http"
@@ -29,6 +30,7 @@ func newWebServer(bind string, logger logging.Logger, sprinkler sensor.Sensor) *
 
 	mux := http.NewServeMux()
 	mux.Handle("/", s)
+	mux.HandleFunc("/history", s.history)
 
 	return &http.Server{Addr: bind, Handler: mux}
 }
@@ -40,14 +42,30 @@ type server struct {
 
 type zoneInfo struct {
 	Name         string
-	MinutesSoFar float64
+	MinutesSoFar float64 // time it really ran
 	MinutesConf  int
+
+	// credits and debits against MinutesConf
+	RainMinutes   float64
+	HeatMinutes   float64
+	ColdMinutes   float64
+	MarkedMinutes float64
+	TargetMinutes float64
+	Fault         string
+	PinFaults     int
+
+	LitersToday float64
+	LitersWeek  float64
+	LitersMonth float64
 }
 
 type info struct {
 	Zones     []zoneInfo
+	HasVolume bool
 	Running   string
 	PauseTill string
+	Suspended string
+	Alert     string
 	Message   string
 
 	TotalMinutesLeft float64
@@ -81,6 +99,8 @@ func (s *server) getData() (*info, error) {
 
 	i.Running = readings["running"].(string)
 	i.PauseTill = readings["pause_till"].(string)
+	i.Suspended, _ = readings["suspended"].(string)
+	i.Alert, _ = readings["alert"].(string)
 
 	ordered, err := s.sprinkler.DoCommand(context.Background(), map[string]interface{}{"cmd": "order"})
 	if err != nil {
@@ -109,8 +129,31 @@ func (s *server) getData() (*info, error) {
 				z.MinutesConf = int(xx)
 			}
 		}
+		z.RainMinutes, _ = readings[z.Name+"-rain-minutes"].(float64)
+		z.HeatMinutes, _ = readings[z.Name+"-heat-minutes"].(float64)
+		z.ColdMinutes, _ = readings[z.Name+"-cold-minutes"].(float64)
+		z.MarkedMinutes, _ = readings[z.Name+"-marked-minutes"].(float64)
+		z.TargetMinutes, _ = readings[z.Name+"-target"].(float64)
+
+		z.Fault, _ = readings[z.Name+"-fault"].(string)
+
+		// over grpc every number comes back as a float64
+		switch x := readings[z.Name+"-pin-faults"].(type) {
+		case int:
+			z.PinFaults = x
+		case float64:
+			z.PinFaults = int(x)
+		}
+
+		z.LitersToday, ok = readings[z.Name+"-liters"].(float64)
+		if ok {
+			i.HasVolume = true
+			z.LitersWeek, _ = readings[z.Name+"-liters-week"].(float64)
+			z.LitersMonth, _ = readings[z.Name+"-liters-month"].(float64)
+		}
+
 		i.Zones = append(i.Zones, z)
-		i.TotalMinutesLeft += max(0, float64(z.MinutesConf)-z.MinutesSoFar)
+		i.TotalMinutesLeft += max(0, z.TargetMinutes-z.MinutesSoFar)
 	}
 
 	return i, nil
@@ -160,6 +203,29 @@ func (s *server) processData(r *http.Request) (string, error) {
 		return fmt.Sprintf("marking zone done %s for %v minutes", z, m), nil
 	}
 
+	if q.Has("clearFault") {
+		z := q.Get("clearFault")
+		_, err := s.sprinkler.DoCommand(context.Background(),
+			map[string]interface{}{
+				"cmd":  "clearFault",
+				"zone": z,
+			})
+		if err != nil {
+			return "", fmt.Errorf("cannot clear fault %v", err)
+		}
+
+		return fmt.Sprintf("cleared fault on zone %s", z), nil
+	}
+
+	if q.Has("clearAlert") {
+		_, err := s.sprinkler.DoCommand(context.Background(), map[string]interface{}{"cmd": "clearAlert"})
+		if err != nil {
+			return "", fmt.Errorf("cannot clear alert %v", err)
+		}
+
+		return "cleared alert", nil
+	}
+
 	if q.Has("pause") {
 		m, err := strconv.ParseFloat(q.Get("pause"), 64)
 		if err != nil {
@@ -182,6 +248,29 @@ func (s *server) processData(r *http.Request) (string, error) {
 	return "", nil
 }
 
+// history is the history do command as json, ex: /history?zone=z1&from=2025-06-01&to=2025-06-30
+func (s *server) history(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	cmd := map[string]interface{}{"cmd": "history"}
+	for _, k := range []string{"zone", "from", "to"} {
+		if q.Has(k) {
+			cmd[k] = q.Get(k)
+		}
+	}
+
+	res, err := s.sprinkler.DoCommand(r.Context(), cmd)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("cannot get history %v", err), 400)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		s.logger.Warnf("cannot write history %v", err)
+	}
+}
+
 func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	msg, err := s.processData(r)
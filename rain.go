@@ -1,128 +1,201 @@
 package sprinkler
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
-	//"sync"
+	"sync"
 	"time"
 
 	"github.com/icodealot/noaa"
 )
 
-/*
-	type rainCacheData struct {
-		totalRain float64
-		when      time.Time
-	}
+type rainCacheData struct {
+	totalRain float64
+	when      time.Time
+}
 
-	type rainCache struct {
-		cache map[string]rainCacheData
-		lock  sync.Mutex
-	}
+// rainCache remembers how much rain a station saw so we don't hit noaa every loop
+type rainCache struct {
+	cache map[string]rainCacheData
+	lock  sync.Mutex
 
-	func (rc *rainCache) rain(station string, hours int) (float64, error) {
-		rc.lock.Lock()
-		defer rc.lock.Unlock()
+	observations func(station string) (*noaa.ObservationsResponse, error) // noaa.Observations, but tests can swap it
+}
 
-		key := fmt.Sprintf("%s-%d", station, hours)
+func (rc *rainCache) rain(station string, hours int, now time.Time) (float64, error) {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
 
-		if rc.cache == nil {
-			rc.cache = map[string]rainCacheData{}
-		} else {
-			old := rc.cache[key]
-			if time.Since(old.when) < 10*time.Minute {
-				return old.totalRain, nil
-			}
-		}
+	key := fmt.Sprintf("%s-%d", station, hours)
 
-		r, err := rain(station, hours)
-		if err != nil {
-			return 0, err
+	if rc.cache == nil {
+		rc.cache = map[string]rainCacheData{}
+	} else {
+		old, ok := rc.cache[key]
+		if ok && now.Sub(old.when) < 10*time.Minute {
+			return old.totalRain, nil
 		}
+	}
 
-		rc.cache[key] = rainCacheData{r, time.Now()}
-		return r, nil
+	f := rc.observations
+	if f == nil {
+		f = noaa.Observations
 	}
 
-	func rain(station string, hours int) (float64, error) {
-		resp, err := noaa.Observations(station)
-		if err != nil {
-			return 0, err
-		}
+	resp, err := f(station)
+	if err != nil {
+		return 0, fmt.Errorf("cannot get observations for station %s: %w", station, err)
+	}
 
-		totalRain := 0.0
+	r := rainFromObservations(resp.Observations, now, hours)
+	fmt.Printf("station: %s totalRain: %v\n", station, r)
 
-		for _, o := range resp.Observations {
-			if time.Since(o.Timestamp) > (time.Hour * time.Duration(hours)) {
-				continue
-			}
+	rc.cache[key] = rainCacheData{r, now}
+	return r, nil
+}
+
+// rainFromObservations is how many mm of rain fell in the last hours
+func rainFromObservations(observations []noaa.Observation, now time.Time, hours int) float64 {
+	totalRain := 0.0
 
-			totalRain += o.PrecipitationLastHour.Value
+	for _, o := range observations {
+		if now.Sub(o.Timestamp) > (time.Hour*time.Duration(hours)) || o.Timestamp.After(now) {
+			continue
 		}
-		fmt.Printf("station: %s totalRain: %v\n", station, totalRain)
-		return totalRain, nil
-	}
-*/
-const (
-	rainMagic = "rainMagic"
-)
 
-// hours: the number of hours into the future to look
-// return mmOfRain, maxTemp
-func rainPrediction(lat, long string, hours int) (float64, float64, error) {
-	if lat == rainMagic && long == rainMagic {
-		return 5.0, 26.0, nil
+		v := o.PrecipitationLastHour
+		if v.UnitCode == "wmoUnit:m" {
+			totalRain += v.Value * 1000
+		} else {
+			totalRain += v.Value
+		}
 	}
+	return totalRain
+}
+
+type noaaWeather struct {
+	lat, long string
+}
 
-	r, err := noaa.GridpointForecast(lat, long)
+func (w *noaaWeather) Forecast(ctx context.Context) ([]HourlyWeather, error) {
+	r, err := noaa.GridpointForecast(w.lat, w.long)
 	if err != nil {
-		return 0, 0, fmt.Errorf("cannot get grid forecast for %v, %v %v", lat, long, err)
+		return nil, fmt.Errorf("cannot get grid forecast for %v, %v %v", w.lat, w.long, err)
 	}
 
-	x := r.QuantitativePrecipitation
+	hours := map[time.Time]*HourlyWeather{}
+	get := func(t time.Time) *HourlyWeather {
+		h, ok := hours[t]
+		if !ok {
+			h = &HourlyWeather{Time: t}
+			hours[t] = h
+		}
+		return h
+	}
 
-	if x.Uom != "wmoUnit:mm" {
-		return 0, 0, fmt.Errorf("unit is not mm %v", x.Uom)
+	// each value covers a time range, rain gets spread over it, everything else is the same for every hour
+	type series struct {
+		x      noaa.GridpointForecastTimeSeries
+		uom    string
+		spread bool
+		set    func(h *HourlyWeather, v float64)
 	}
 
-	end := time.Now().Add(time.Duration(hours) * time.Hour)
+	all := []series{
+		{r.QuantitativePrecipitation, "wmoUnit:mm", true, func(h *HourlyWeather, v float64) { h.PrecipitationMM = v }},
+		{r.Temperature, "wmoUnit:degC", false, func(h *HourlyWeather, v float64) { h.TemperatureC = v }},
+		{r.RelativeHumidity, "wmoUnit:percent", false, func(h *HourlyWeather, v float64) { h.Humidity = v }},
+		{r.WindSpeed, "wmoUnit:km_h-1", false, func(h *HourlyWeather, v float64) { h.WindSpeed = v / 3.6 }},
+	}
 
-	total := 0.0
-	for _, z := range x.Values {
-		t, err := parseTime(z.ValidTime)
-		if err != nil {
-			return 0, 0, err
+	for _, s := range all {
+		if s.x.Uom != s.uom {
+			return nil, fmt.Errorf("unit is not %v, got %v", s.uom, s.x.Uom)
 		}
 
-		if t.After(end) {
-			continue
+		for _, z := range s.x.Values {
+			t, d, err := parseValidTime(z.ValidTime)
+			if err != nil {
+				return nil, err
+			}
+
+			n := max(1, int(d/time.Hour))
+			v := z.Value
+			if s.spread {
+				v /= float64(n)
+			}
+
+			for i := 0; i < n; i++ {
+				s.set(get(t.Add(time.Duration(i)*time.Hour)), v)
+			}
 		}
+	}
 
-		total += z.Value
+	res := []HourlyWeather{}
+	for _, h := range hours {
+		res = append(res, *h)
 	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Time.Before(res[j].Time) })
+	return res, nil
+}
 
-	x = r.Temperature
-	if x.Uom != "wmoUnit:degC" {
-		return 0, 0, fmt.Errorf("bad unit for time %v", x.Uom)
+// parseValidTime parses noaa's "2023-08-20T12:00:00+00:00/PT3H"
+func parseValidTime(s string) (time.Time, time.Duration, error) {
+	t, err := parseTime(s)
+	if err != nil {
+		return t, 0, err
 	}
 
-	maxTemp := 0.0
-	for _, z := range x.Values {
-		t, err := parseTime(z.ValidTime)
-		if err != nil {
-			return 0, 0, err
-		}
+	d, err := parseISODuration(strings.Split(s, "/")[1])
+	if err != nil {
+		return t, 0, err
+	}
+	return t, d, nil
+}
 
-		if t.After(end) {
-			continue
-		}
+// parseISODuration handles the subset of ISO 8601 durations noaa uses, like P1DT6H or PT30M
+func parseISODuration(s string) (time.Duration, error) {
+	if !strings.HasPrefix(s, "P") {
+		return 0, fmt.Errorf("invalid duration %v", s)
+	}
 
-		if z.Value > maxTemp {
-			maxTemp = z.Value
+	total := time.Duration(0)
+	inTime := false
+	num := ""
+	for _, c := range s[1:] {
+		switch {
+		case c == 'T':
+			inTime = true
+		case c >= '0' && c <= '9':
+			num += string(c)
+		default:
+			n, err := strconv.Atoi(num)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %v", s)
+			}
+			num = ""
+
+			switch {
+			case c == 'D' && !inTime:
+				total += time.Duration(n) * 24 * time.Hour
+			case c == 'H' && inTime:
+				total += time.Duration(n) * time.Hour
+			case c == 'M' && inTime:
+				total += time.Duration(n) * time.Minute
+			case c == 'S' && inTime:
+				total += time.Duration(n) * time.Second
+			default:
+				return 0, fmt.Errorf("invalid duration %v", s)
+			}
 		}
 	}
-	fmt.Printf("yo %v\n", maxTemp)
-	return total, maxTemp, nil
+	if num != "" {
+		return 0, fmt.Errorf("invalid duration %v", s)
+	}
+	return total, nil
 }
 
 func parseTime(s string) (time.Time, error) {
@@ -1,41 +1,226 @@
 package sprinkler
 
 import (
+	"context"
 	"testing"
+	"time"
+
+	"github.com/icodealot/noaa"
+	"go.viam.com/rdk/components/board"
+	"go.viam.com/rdk/components/board/fake"
+	"go.viam.com/rdk/logging"
 
 	"go.viam.com/test"
 )
 
 func TestRain2(t *testing.T) {
-	_, _, err := rainPrediction("40.6928592", "-74.3045002", 24)
+	w := &noaaWeather{lat: "40.6928592", long: "-74.3045002"}
+	_, err := w.Forecast(context.Background())
 	test.That(t, err, test.ShouldBeNil)
 
 }
 
-/*
-func TestRain(t *testing.T) {
-	_, err := rain("KJFK", 24)
+func TestParseValidTime(t *testing.T) {
+	start, d, err := parseValidTime("2023-08-20T12:00:00+00:00/PT3H")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, start.UTC().Hour(), test.ShouldEqual, 12)
+	test.That(t, d, test.ShouldEqual, 3*time.Hour)
+
+	d, err = parseISODuration("P1DT6H")
 	test.That(t, err, test.ShouldBeNil)
+	test.That(t, d, test.ShouldEqual, 30*time.Hour)
 
-	var rc rainCache
-	_, err = rc.rain("KJFK", 24)
+	d, err = parseISODuration("PT30M")
 	test.That(t, err, test.ShouldBeNil)
-	test.That(t, len(rc.cache), test.ShouldEqual, 1)
+	test.That(t, d, test.ShouldEqual, 30*time.Minute)
+
+	_, err = parseISODuration("1H")
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = parseISODuration("PT3")
+	test.That(t, err, test.ShouldNotBeNil)
+}
 
-	var old time.Time
-	for _, v := range rc.cache {
-		old = v.when
+func TestRainFromObservations(t *testing.T) {
+	now := time.Date(2026, time.June, 18, 6, 0, 0, 0, time.UTC)
+	obs := []noaa.Observation{
+		{Timestamp: now.Add(-time.Hour), PrecipitationLastHour: noaa.QuantitativeValue{Value: 2, UnitCode: "wmoUnit:mm"}},
+		{Timestamp: now.Add(-5 * time.Hour), PrecipitationLastHour: noaa.QuantitativeValue{Value: 0.003, UnitCode: "wmoUnit:m"}},
+		{Timestamp: now.Add(-30 * time.Hour), PrecipitationLastHour: noaa.QuantitativeValue{Value: 10, UnitCode: "wmoUnit:mm"}},
 	}
 
-	_, err = rc.rain("KJFK", 24)
+	test.That(t, rainFromObservations(obs, now, 24), test.ShouldAlmostEqual, 5)
+	test.That(t, rainFromObservations(obs, now, 2), test.ShouldAlmostEqual, 2)
+	test.That(t, rainFromObservations(obs, now, 48), test.ShouldAlmostEqual, 15)
+}
+
+func TestRainCache(t *testing.T) {
+	now := time.Date(2026, time.June, 18, 6, 0, 0, 0, time.UTC)
+	calls := 0
+	rc := rainCache{observations: func(station string) (*noaa.ObservationsResponse, error) {
+		calls++
+		test.That(t, station, test.ShouldEqual, "KJFK")
+		return &noaa.ObservationsResponse{Observations: []noaa.Observation{
+			{Timestamp: now.Add(-time.Hour), PrecipitationLastHour: noaa.QuantitativeValue{Value: 4}},
+		}}, nil
+	}}
+
+	r, err := rc.rain("KJFK", 24, now)
 	test.That(t, err, test.ShouldBeNil)
-	test.That(t, len(rc.cache), test.ShouldEqual, 1)
+	test.That(t, r, test.ShouldEqual, 4)
+	test.That(t, calls, test.ShouldEqual, 1)
+
+	r, err = rc.rain("KJFK", 24, now.Add(time.Minute))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, r, test.ShouldEqual, 4)
+	test.That(t, calls, test.ShouldEqual, 1)
+
+	_, err = rc.rain("KJFK", 24, now.Add(11*time.Minute))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, calls, test.ShouldEqual, 2)
+}
+
+func TestObservedRainCredit(t *testing.T) {
+	ctx := context.Background()
+	s := sprinkler{
+		config: &sprinklerConfig{
+			StartHour: -1,
+			Station:   "KJFK",
+			Zones:     testSimpleConfig.Zones,
+		},
+		logger: logging.NewTestLogger(t),
+	}
+	f := addDummyPins(&s)
+	defer f()
 
-	var newer time.Time
-	for _, v := range rc.cache {
-		newer = v.when
+	now := time.Date(2026, time.June, 18, 0, 15, 0, 0, time.UTC)
+	s.rainCache.observations = func(station string) (*noaa.ObservationsResponse, error) {
+		return &noaa.ObservationsResponse{Observations: []noaa.Observation{
+			{Timestamp: now.Add(-3 * time.Hour), PrecipitationLastHour: noaa.QuantitativeValue{Value: 10}},
+		}}, nil
 	}
 
-	test.That(t, newer, test.ShouldEqual, old)
+	// no forecast, but we still credit the rain that fell
+	mode, err := s.doRainPrediction_inlock(ctx, now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, mode, test.ShouldEqual, rainDidIt)
+
+	l, err := s.ledger_inlock("b", now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, l.Rain, test.ShouldEqual, 10*time.Minute)
+
+	observed, err := s.stats.AmountWatered("rain_observed", now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, observed.Minutes(), test.ShouldAlmostEqual, 10)
+
+	// 6mm of it was forecast and credited yesterday, so only 4mm is new
+	s.stats, err = NewLocalJSONStore(t.TempDir(), logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, s.stats.AddWeather(WeatherSnapshot{Time: now.Add(-20 * time.Hour), RainMM: 6}), test.ShouldBeNil)
+	s.lastRainCheck = time.Time{}
+	_, err = s.doRainPrediction_inlock(ctx, now)
+	test.That(t, err, test.ShouldBeNil)
+	l, err = s.ledger_inlock("b", now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, l.Rain, test.ShouldEqual, 4*time.Minute)
+
+	// and it's separate from the forecast credit
+	s.stats, err = NewLocalJSONStore(t.TempDir(), logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	s.lastRainCheck = time.Time{}
+	s.weather = &fileWeather{fn: "testdata/forecast.json"}
+	_, err = s.doRainPrediction_inlock(ctx, now)
+	test.That(t, err, test.ShouldBeNil)
+
+	withForecast, err := s.ledger_inlock("b", now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, withForecast.credit(), test.ShouldBeLessThan, l.credit())
+}
+
+func TestRainGauge(t *testing.T) {
+	ctx := context.Background()
+	s := sprinkler{
+		config: &sprinklerConfig{
+			StartHour:          -1,
+			RainGaugeMMPerTick: 0.5,
+			Zones:              testSimpleConfig.Zones,
+		},
+		logger: logging.NewTestLogger(t),
+	}
+	f := addDummyPins(&s)
+	defer f()
+
+	// on the fake board, pin 0 ticks once every time it's read
+	gauge, err := fake.NewDigitalInterrupt(board.DigitalInterruptConfig{Name: "gauge", Pin: "0"})
+	test.That(t, err, test.ShouldBeNil)
+	s.rainGauge = gauge
+
+	yesterday := time.Date(2026, time.June, 17, 20, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		test.That(t, s.readRainGauge_inlock(ctx, yesterday), test.ShouldBeNil)
+	}
+
+	// the first read is the baseline
+	d, err := s.stats.AmountWatered("rain", yesterday)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, d.Minutes(), test.ShouldAlmostEqual, 2)
+
+	// the gauge wins over the forecast
+	now := time.Date(2026, time.June, 18, 0, 15, 0, 0, time.UTC)
+	s.weather = &fileWeather{fn: "testdata/forecast.json"} // 5mm of rain, 26C
+	mode, err := s.doRainPrediction_inlock(ctx, now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, mode, test.ShouldEqual, rainDidIt)
+
+	observed, err := s.stats.AmountWatered("rain_observed", now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, observed.Minutes(), test.ShouldAlmostEqual, 2)
+
+	// c: 5 minutes, 2mm of rain is -.5 minutes, 26C is +3:20
+	l, err := s.ledger_inlock("c", now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, l.Rain.Round(time.Second), test.ShouldEqual, 30*time.Second)
+	test.That(t, l.Heat.Round(time.Second), test.ShouldEqual, 3*time.Minute+20*time.Second)
+	test.That(t, l.Ran, test.ShouldEqual, 0)
+
+	// a board restart resets the count, that's not rain
+	s.rainGaugeTicks = 1000
+	test.That(t, s.readRainGauge_inlock(ctx, now), test.ShouldBeNil)
+	d, err = s.stats.AmountWatered("rain", now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, d, test.ShouldEqual, 0)
+}
+
+func TestRainGaugeOnly(t *testing.T) {
+	ctx := context.Background()
+	s := sprinkler{
+		config: &sprinklerConfig{
+			StartHour:          -1,
+			RainGaugeMMPerTick: 1,
+			Zones:              testSimpleConfig.Zones,
+		},
+		logger: logging.NewTestLogger(t),
+	}
+	f := addDummyPins(&s)
+	defer f()
+
+	gauge, err := fake.NewDigitalInterrupt(board.DigitalInterruptConfig{Name: "gauge", Pin: "0"})
+	test.That(t, err, test.ShouldBeNil)
+	s.rainGauge = gauge
+
+	yesterday := time.Date(2026, time.June, 17, 20, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		test.That(t, s.readRainGauge_inlock(ctx, yesterday), test.ShouldBeNil)
+	}
+
+	// no forecast and no station, the gauge is still counted
+	now := time.Date(2026, time.June, 18, 0, 15, 0, 0, time.UTC)
+	mode, err := s.doRainPrediction_inlock(ctx, now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, mode, test.ShouldEqual, rainDidIt)
+
+	// b: 20 minutes, 4mm of rain is 4 minutes
+	l, err := s.ledger_inlock("b", now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, l.Rain, test.ShouldEqual, 4*time.Minute)
+	test.That(t, l.Heat, test.ShouldEqual, 0)
 }
-*/
@@ -2,12 +2,16 @@ package sprinkler
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"os"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.viam.com/rdk/components/board"
@@ -23,17 +27,148 @@ type ZoneConfig struct {
 	Pin      string
 	Minutes  int
 	Priority int
+
+	Board     string // use a pin on this board instead of the global one
+	Switch    string // a switch component that turns the zone on and off, instead of a pin
+	ActiveLow *bool  `json:"active_low"` // overrides the global active_low
+
+	// latching valves get a pulse on OpenPin or ClosePin instead of holding Pin
+	Valve       string // level (default) or latching
+	OpenPin     string `json:"open_pin"`
+	ClosePin    string `json:"close_pin"`
+	PulseMillis int    `json:"pulse_ms"` // default 50
+
+	// override the global values if set
+	MaxTimeSliceMinutes int `json:"max_time_slice_minutes"`
+	MinSoakMinutes      int `json:"min_soak_minutes"`
+	MaxRunMinutes       int `json:"max_run_minutes"`
+
+	Flow float64 // how much water the zone uses, in the same units as max_flow
+
+	// water balance, if ApplicationRateMMPerHour is set Minutes is ignored and
+	// we water based on evapotranspiration instead
+	CropCoefficient          float64 `json:"crop_coefficient"`
+	RootDepthMM              float64 `json:"root_depth_mm"`
+	AvailableWater           float64 `json:"available_water"` // mm of water per mm of soil
+	ApplicationRateMMPerHour float64 `json:"application_rate_mm_per_hour"`
+	DepletionThreshold       float64 `json:"depletion_threshold"` // fraction of available water, default .5
+}
+
+func (z ZoneConfig) usesWaterBalance() bool {
+	return z.ApplicationRateMMPerHour > 0
+}
+
+// capacity is how many mm of water the root zone can hold
+func (z ZoneConfig) capacity() float64 {
+	return z.RootDepthMM * z.AvailableWater
+}
+
+func (z ZoneConfig) depletionThreshold() float64 {
+	if z.DepletionThreshold > 0 {
+		return z.DepletionThreshold
+	}
+	return DefaultDepletionThreshold
+}
+
+func (z ZoneConfig) validateWaterBalance() error {
+	if !z.usesWaterBalance() {
+		return nil
+	}
+	if z.CropCoefficient <= 0 || z.RootDepthMM <= 0 || z.AvailableWater <= 0 {
+		return fmt.Errorf("crop_coefficient, root_depth_mm and available_water are required with application_rate_mm_per_hour")
+	}
+	if z.DepletionThreshold < 0 || z.DepletionThreshold > 1 {
+		return fmt.Errorf("depletion_threshold has to be between 0 and 1")
+	}
+	return nil
+}
+
+// WindowConfig is a time of day range we're allowed to water in, "HH:MM" local time
+type WindowConfig struct {
+	Start string
+	End   string
+}
+
+func (w WindowConfig) minutes() (int, int, error) {
+	start, err := parseTimeOfDay(w.Start)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseTimeOfDay(w.End)
+	if err != nil {
+		return 0, 0, err
+	}
+	if end <= start {
+		return 0, 0, fmt.Errorf("window end (%s) has to be after start (%s)", w.End, w.Start)
+	}
+	return start, end, nil
+}
+
+// parseTimeOfDay turns "HH:MM" into minutes since midnight
+func parseTimeOfDay(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day [%s], needs to be HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
 }
 
 type sprinklerConfig struct {
 	Board       string
+	ActiveLow   bool   `json:"active_low"` // relays that turn on when the pin is low, also used for the master
 	StartHour   int    `json:"start_hour"`
 	StartMinute int    `json:"start_minute"`
 	DataDir     string `json:"data_dir"`
-	Zones     map[string]ZoneConfig
-	Lat       string
-	Long      string
-	SkipDays  []int `json:"skip_days"`
+	Store       string // files (default) or sqlite
+	// how often the files store writes the day's totals out, default 60
+	FlushSeconds float64 `json:"flush_seconds"`
+	Zones        map[string]ZoneConfig
+	Lat          string
+	Long         string
+	SkipDays     []int `json:"skip_days"`
+
+	Weather     string // noaa (default), open-meteo or file
+	WeatherFile string `json:"weather_file"`
+	Station     string // noaa station to get rain that actually fell from, ex: KJFK
+
+	// a tipping bucket rain gauge on a board digital interrupt
+	RainGauge          string  `json:"rain_gauge"`
+	RainGaugeMMPerTick float64 `json:"rain_gauge_mm_per_tick"`
+
+	// a pulse output flow meter on a board digital interrupt
+	FlowMeter               string  `json:"flow_meter"`
+	FlowMeterPulsesPerLiter float64 `json:"flow_meter_pulses_per_liter"`
+
+	// leak detection, needs the flow meter
+	LeakFactor              float64 `json:"leak_factor"`                 // alert when flow is this many times normal, default 1.5
+	LeakShutoff             bool    `json:"leak_shutoff"`                // turn the zone off and mark it faulted on a leak
+	IdleFlowLitersPerMinute float64 `json:"idle_flow_liters_per_minute"` // alert above this with no zone on, default .5
+
+	// normally closed switches, when one opens we stop watering
+	RainSensorPin   string `json:"rain_sensor_pin"`
+	FreezeSensorPin string `json:"freeze_sensor_pin"`
+
+	// a master valve or pump relay that's on whenever any zone is
+	MasterPin              string  `json:"master_pin"`
+	MasterPreOpenSeconds   float64 `json:"master_pre_open_seconds"`   // how long the master is on before a zone opens
+	MasterPostCloseSeconds float64 `json:"master_post_close_seconds"` // how long the master stays on after the zones close
+
+	// if set, we only water inside these, and StartHour/StartMinute are ignored
+	Windows []WindowConfig
+
+	// cycle and soak: a zone runs at most MaxTimeSliceMinutes at a time,
+	// and then has to sit for MinSoakMinutes before it can run again.
+	MaxTimeSliceMinutes int `json:"max_time_slice_minutes"`
+	MinSoakMinutes      int `json:"min_soak_minutes"`
+
+	// a zone is never on longer than this in one stretch, no matter what, default 120
+	MaxRunMinutes int `json:"max_run_minutes"`
+
+	// if set, zones can run together as long as their flow adds up to less than this
+	MaxFlow float64 `json:"max_flow"`
+
+	// if the loop doesn't get around for this long, turn everything off
+	WatchdogSeconds float64 `json:"watchdog_seconds"`
 }
 
 func (cfg sprinklerConfig) SkipDay(now time.Time) bool {
@@ -45,13 +180,192 @@ func (cfg sprinklerConfig) SkipDay(now time.Time) bool {
 	return false
 }
 
+func (cfg sprinklerConfig) leakFactor() float64 {
+	if cfg.LeakFactor > 0 {
+		return cfg.LeakFactor
+	}
+	return DefaultLeakFactor
+}
+
+func (cfg sprinklerConfig) idleFlow() float64 {
+	if cfg.IdleFlowLitersPerMinute > 0 {
+		return cfg.IdleFlowLitersPerMinute
+	}
+	return DefaultIdleFlowLitersPerMinute
+}
+
+func (cfg sprinklerConfig) flushInterval() time.Duration {
+	return time.Duration(cfg.FlushSeconds * float64(time.Second))
+}
+
+func (cfg sprinklerConfig) usesWaterBalance() bool {
+	for _, z := range cfg.Zones {
+		if z.usesWaterBalance() {
+			return true
+		}
+	}
+	return false
+}
+
+// inWindow returns if we're allowed to water at this time of day
+func (cfg sprinklerConfig) inWindow(now time.Time) bool {
+	minuteOfDay := now.Hour()*60 + now.Minute()
+
+	if len(cfg.Windows) == 0 {
+		return cfg.StartHour < 0 || minuteOfDay >= cfg.StartHour*60+cfg.StartMinute
+	}
+
+	for _, w := range cfg.Windows {
+		start, end, err := w.minutes()
+		if err != nil {
+			continue
+		}
+		if minuteOfDay >= start && minuteOfDay < end {
+			return true
+		}
+	}
+	return false
+}
+
+// timeSlice is the longest a zone can run in one stretch, 0 means no limit
+func (cfg sprinklerConfig) timeSlice(zone string) time.Duration {
+	m := cfg.MaxTimeSliceMinutes
+	if z := cfg.Zones[zone]; z.MaxTimeSliceMinutes > 0 {
+		m = z.MaxTimeSliceMinutes
+	}
+	return time.Duration(m) * time.Minute
+}
+
+// onLevel is what a zone's pin has to be set to for the valve to be open
+func (cfg sprinklerConfig) onLevel(zone string) bool {
+	if z := cfg.Zones[zone]; z.ActiveLow != nil {
+		return !*z.ActiveLow
+	}
+	return !cfg.ActiveLow
+}
+
+// maxRun is the longest a zone can ever be on in one stretch
+func (cfg sprinklerConfig) maxRun(zone string) time.Duration {
+	m := DefaultMaxRunMinutes
+	if cfg.MaxRunMinutes > 0 {
+		m = cfg.MaxRunMinutes
+	}
+	if z := cfg.Zones[zone]; z.MaxRunMinutes > 0 {
+		m = z.MaxRunMinutes
+	}
+	return time.Duration(m) * time.Minute
+}
+
+// soakTime is how long a zone has to be off before it can run again
+func (cfg sprinklerConfig) soakTime(zone string) time.Duration {
+	m := cfg.MinSoakMinutes
+	if z := cfg.Zones[zone]; z.MinSoakMinutes > 0 {
+		m = z.MinSoakMinutes
+	}
+	return time.Duration(m) * time.Minute
+}
+
+// needsBoard is if anything uses the global board
+func (cfg sprinklerConfig) needsBoard() bool {
+	if cfg.MasterPin != "" || cfg.RainSensorPin != "" || cfg.FreezeSensorPin != "" || cfg.RainGauge != "" || cfg.FlowMeter != "" {
+		return true
+	}
+	for _, z := range cfg.Zones {
+		if z.Switch == "" && z.Board == "" {
+			return true
+		}
+	}
+	return false
+}
+
 func (cfg sprinklerConfig) Validate(path string) ([]string, []string, error) {
-	deps := []string{cfg.Board}
+	deps := []string{}
 
-	if cfg.Board == "" {
+	if cfg.Board != "" {
+		deps = append(deps, cfg.Board)
+	} else if cfg.needsBoard() {
 		return nil, nil, utils.NewConfigValidationFieldRequiredError(path, "board")
 	}
 
+	for _, n := range cfg.zoneOrder() {
+		z := cfg.Zones[n]
+		for _, d := range []string{z.Board, z.Switch} {
+			if d != "" && !slices.Contains(deps, d) {
+				deps = append(deps, d)
+			}
+		}
+	}
+
+	if cfg.MaxTimeSliceMinutes < 0 || cfg.MinSoakMinutes < 0 || cfg.MaxRunMinutes < 0 {
+		return nil, nil, fmt.Errorf("max_time_slice_minutes, min_soak_minutes and max_run_minutes cannot be negative")
+	}
+	if cfg.MaxFlow < 0 {
+		return nil, nil, fmt.Errorf("max_flow cannot be negative")
+	}
+
+	if cfg.MasterPreOpenSeconds < 0 || cfg.MasterPostCloseSeconds < 0 {
+		return nil, nil, fmt.Errorf("master_pre_open_seconds and master_post_close_seconds cannot be negative")
+	}
+
+	if cfg.FlowMeter != "" && cfg.FlowMeterPulsesPerLiter <= 0 {
+		return nil, nil, fmt.Errorf("flow_meter_pulses_per_liter is required with flow_meter")
+	}
+
+	if cfg.LeakFactor < 0 || cfg.IdleFlowLitersPerMinute < 0 {
+		return nil, nil, fmt.Errorf("leak_factor and idle_flow_liters_per_minute cannot be negative")
+	}
+	if cfg.LeakFactor > 0 && cfg.LeakFactor <= 1 {
+		return nil, nil, fmt.Errorf("leak_factor has to be more than 1")
+	}
+
+	if cfg.Store != "" && cfg.Store != storeFiles && cfg.Store != storeSQLite {
+		return nil, nil, fmt.Errorf("store has to be %s or %s, not [%s]", storeFiles, storeSQLite, cfg.Store)
+	}
+
+	if cfg.FlushSeconds < 0 {
+		return nil, nil, fmt.Errorf("flush_seconds cannot be negative")
+	}
+
+	if cfg.WatchdogSeconds < 0 || (cfg.WatchdogSeconds > 0 && cfg.WatchdogSeconds < minWatchdogSeconds) {
+		return nil, nil, fmt.Errorf("watchdog_seconds has to be at least %d", minWatchdogSeconds)
+	}
+
+	if cfg.RainGaugeMMPerTick < 0 {
+		return nil, nil, fmt.Errorf("rain_gauge_mm_per_tick cannot be negative")
+	}
+
+	if _, err := newWeatherProvider(&cfg); err != nil {
+		return nil, nil, err
+	}
+
+	for idx, w := range cfg.Windows {
+		if _, _, err := w.minutes(); err != nil {
+			return nil, nil, fmt.Errorf("windows[%d]: %w", idx, err)
+		}
+	}
+
+	for n, z := range cfg.Zones {
+		if z.MaxTimeSliceMinutes < 0 || z.MinSoakMinutes < 0 || z.MaxRunMinutes < 0 {
+			return nil, nil, fmt.Errorf("zone %s: max_time_slice_minutes, min_soak_minutes and max_run_minutes cannot be negative", n)
+		}
+		if z.Flow < 0 {
+			return nil, nil, fmt.Errorf("zone %s: flow cannot be negative", n)
+		}
+		if cfg.MaxFlow > 0 && z.Flow == 0 {
+			// a zone with no flow would always fit, and get around the budget
+			return nil, nil, fmt.Errorf("zone %s: flow is required with max_flow", n)
+		}
+		if err := z.validateValve(); err != nil {
+			return nil, nil, fmt.Errorf("zone %s: %w", n, err)
+		}
+		if err := z.validateWaterBalance(); err != nil {
+			return nil, nil, fmt.Errorf("zone %s: %w", n, err)
+		}
+		if z.usesWaterBalance() && (cfg.Lat == "" || cfg.Long == "") {
+			return nil, nil, fmt.Errorf("zone %s: lat and long are required for the water balance", n)
+		}
+	}
+
 	return deps, nil, nil
 }
 
@@ -111,22 +425,18 @@ func newSprinkler(ctx context.Context, deps resource.Dependencies, config resour
 		return nil, err
 	}
 
-	r, err := deps.Lookup(board.Named(s.config.Board))
+	// with nothing running yet, this also turns everything off, whatever state the valves were left in
+	err = s.Reconfigure(ctx, deps, config)
 	if err != nil {
 		return nil, err
 	}
 
-	s.theBoard = r.(board.Board)
-
-	for name, z := range newConf.Zones {
-		p, err := s.theBoard.GPIOPinByName(z.Pin)
-		if err != nil {
-			return nil, fmt.Errorf("error getting pin (%s)", z.Pin)
-		}
-		s.pins[name] = p
-	}
-
+	s.backgroundContext, s.backgroundCancel = context.WithCancel(context.Background())
+	s.loopDone = make(chan struct{})
+	s.wake = make(chan struct{}, 1)
+	s.beat(time.Now())
 	go s.run()
+	go s.runWatchdog()
 
 	s.webServer = newWebServer(":9999", logger, s)
 	go func() {
@@ -138,57 +448,292 @@ func newSprinkler(ctx context.Context, deps resource.Dependencies, config resour
 	return s, nil
 }
 
-type sprinkler struct {
-	resource.AlwaysRebuild
+// Reconfigure swaps in new hardware and settings without losing what's running, paused or forced
+func (s *sprinkler) Reconfigure(ctx context.Context, deps resource.Dependencies, config resource.Config) error {
+	newConf, err := resource.NativeConfig[*sprinklerConfig](config)
+	if err != nil {
+		return err
+	}
+	newConf.setDefaults()
 
+	var theBoard board.Board
+	if newConf.Board != "" {
+		r, err := deps.Lookup(board.Named(newConf.Board))
+		if err != nil {
+			return err
+		}
+		theBoard = r.(board.Board)
+	}
+
+	valves := map[string]valve{}
+	for name, z := range newConf.Zones {
+		if old, ok := s.valves[name]; ok && s.config != nil && z.sameValve(s.config.Zones[name]) {
+			// a new latching valve doesn't know where it is and would get pulsed again
+			valves[name] = old
+			continue
+		}
+		valves[name], err = s.newValve(deps, theBoard, name, z)
+		if err != nil {
+			return fmt.Errorf("zone %s: %w", name, err)
+		}
+	}
+
+	pin := func(name, what string) (board.GPIOPin, error) {
+		if name == "" {
+			return nil, nil
+		}
+		p, err := theBoard.GPIOPinByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("error getting %s pin (%s)", what, name)
+		}
+		return p, nil
+	}
+
+	interrupt := func(name, what string) (board.DigitalInterrupt, error) {
+		if name == "" {
+			return nil, nil
+		}
+		i, err := theBoard.DigitalInterruptByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("error getting %s interrupt (%s)", what, name)
+		}
+		return i, nil
+	}
+
+	masterPin, err := pin(newConf.MasterPin, "master")
+	if err != nil {
+		return err
+	}
+	rainSensor, err := pin(newConf.RainSensorPin, "rain sensor")
+	if err != nil {
+		return err
+	}
+	freezeSensor, err := pin(newConf.FreezeSensorPin, "freeze sensor")
+	if err != nil {
+		return err
+	}
+	flowMeter, err := interrupt(newConf.FlowMeter, "flow meter")
+	if err != nil {
+		return err
+	}
+	rainGauge, err := interrupt(newConf.RainGauge, "rain gauge")
+	if err != nil {
+		return err
+	}
+
+	weather, err := newWeatherProvider(newConf)
+	if err != nil {
+		return err
+	}
+
+	s.statsLock.Lock()
+	s.valveLock.Lock()
+
+	// close whatever we won't be driving anymore, while we still can
+	var errs []error
+	for name, v := range s.valves {
+		z, ok := newConf.Zones[name]
+		if ok && z.sameValve(s.config.Zones[name]) {
+			continue
+		}
+		changed, err := v.set(ctx, false)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cannot turn off old zone (%s): %w", name, err))
+		}
+		if changed {
+			s.recordValve(name, false, why{cause: causeConfig})
+		}
+	}
+	if s.masterPin != nil && (s.config.MasterPin != newConf.MasterPin || s.config.Board != newConf.Board) {
+		errs = append(errs, s.masterOff(ctx))
+	}
+
+	oldConf := s.config
+	s.swapLock.Lock()
+	s.config = newConf
+	s.valves = valves
+	s.masterPin = masterPin
+	s.swapLock.Unlock()
+	s.watchdogTimeout.Store(int64(newConf.watchdogTimeout()))
+	s.theBoard = theBoard
+	s.rainSensor = rainSensor
+	s.freezeSensor = freezeSensor
+	if oldConf.FlowMeter != newConf.FlowMeter || oldConf.Board != newConf.Board {
+		s.flowMeterHavePulse = false
+	}
+	s.flowMeter = flowMeter
+	if oldConf.RainGauge != newConf.RainGauge || oldConf.Board != newConf.Board {
+		s.rainGaugeHaveTick = false
+	}
+	s.rainGauge = rainGauge
+	s.weather = weather
+
+	// the event log gets written under valveLock, so swap the store under it too
+	if oldConf.DataDir != newConf.DataDir || oldConf.Store != newConf.Store || oldConf.FlushSeconds != newConf.FlushSeconds {
+		err = s.openDataDir()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	s.valveLock.Unlock()
+
+	running := []string{}
+	for _, z := range s.running {
+		if _, ok := newConf.Zones[z]; ok {
+			running = append(running, z)
+		}
+	}
+	s.setRunning_inlock(running, time.Now())
+	s.statsLock.Unlock()
+
+	// new zones start off, and the ones that are running keep going
+	errs = append(errs, s.stopAllExcept(ctx, why{cause: causeConfig}, running...))
+	return errors.Join(errs...)
+}
+
+type sprinkler struct {
 	config *sprinklerConfig
 	name   resource.Name
 	logger logging.Logger
 
 	backgroundContext context.Context
 	backgroundCancel  context.CancelFunc
-
+	loopDone          chan struct{}
+	wake              chan struct{}
+
+	heartbeat       atomic.Int64 // unix nanos of the last time the loop went around
+	watchdogTripped atomic.Bool
+	watchdogTimeout atomic.Int64 // so the watchdog doesn't need a lock to read the config
+
+	// valveLock is held while the valves are being set, or swapped on reconfigure
+	valveLock sync.Mutex
+	// swapLock is only held while config, valves and masterPin are swapped, so
+	// the watchdog can close the valves when whatever has valveLock is stuck
+	swapLock  sync.RWMutex
 	theBoard  board.Board
-	pins      map[string]board.GPIOPin
+	valves    map[string]valve
+	masterPin board.GPIOPin
 	webServer *http.Server
 
+	rainGauge         board.DigitalInterrupt
+	rainGaugeTicks    int64
+	rainGaugeHaveTick bool
+
+	flowMeter          board.DigitalInterrupt
+	flowMeterPulses    int64
+	flowMeterHavePulse bool
+	flowMeterTime      time.Time
+	flowBaseline       flowBaseline
+	flowBaselineDirty  bool // learned since it was last saved
+	flowBaselineSaved  time.Time
+
+	rainSensor   board.GPIOPin
+	freezeSensor board.GPIOPin
+
 	statsLock     sync.Mutex
-	stats         DataAPI
-	running       string // what sprinkler is running now
+	stats         DataAPI              // swapped under both locks, the event log is written under valveLock
+	running       []string             // what zones are running now
+	runningSince  map[string]time.Time // when the current time slice started
+	onSince       map[string]time.Time // when the zone last went on, slices don't reset it
+	lastStopped   map[string]time.Time // when each zone was last turned off, for soaking
+	restTill      map[string]time.Time // zones that hit their max run can't go again till then
 	lastLoop      time.Time
 	pauseTillTime time.Time
 	forceZone     string
 	forceTill     time.Time
-
+	holdTill      map[string]time.Time // zones someone turned off by hand
+	suspended     string               // why a rain or freeze sensor has us stopped
+	faults        map[string]string    // zones we won't run till someone looks at them, and why
+	alert         string               // the last thing that went wrong that a person should know about
+
+	// how many times each relay didn't do what it was told, zone name or masterPinName
+	// not under statsLock since the pins get set outside it
+	pinFaultsLock sync.Mutex
+	pinFaults     map[string]int
+
+	weather       WeatherProvider
+	rainCache     rainCache
 	lastRainCheck time.Time
+	balance       *waterBalance
 }
 
-func (s *sprinkler) init() error {
-	s.pins = map[string]board.GPIOPin{}
-	var err error
-	if s.config.DataDir == "" {
-		s.config.DataDir = "sprinkler_data"
+func (cfg *sprinklerConfig) setDefaults() {
+	if cfg.DataDir == "" {
+		cfg.DataDir = "sprinkler_data"
 	}
 
 	// Default start time is 00:15. We start a bit after midnight rather than
 	// exactly at it so the loop isn't accruing/reading right as the per-day
 	// data file rolls over at the calendar boundary.
-	if s.config.StartHour == 0 && s.config.StartMinute == 0 {
-		s.config.StartMinute = 15
+	if cfg.StartHour == 0 && cfg.StartMinute == 0 {
+		cfg.StartMinute = 15
+	}
+
+	if cfg.FlushSeconds == 0 {
+		cfg.FlushSeconds = DefaultFlushSeconds
 	}
 
-	err = os.MkdirAll(s.config.DataDir, os.ModePerm)
+	if cfg.RainGaugeMMPerTick == 0 {
+		cfg.RainGaugeMMPerTick = DefaultRainGaugeMMPerTick
+	}
+}
+
+func (s *sprinkler) init() error {
+	s.valves = map[string]valve{}
+	s.lastStopped = map[string]time.Time{}
+	s.restTill = map[string]time.Time{}
+	s.runningSince = map[string]time.Time{}
+	s.onSince = map[string]time.Time{}
+	s.holdTill = map[string]time.Time{}
+	s.faults = map[string]string{}
+	s.pinFaults = map[string]int{}
+	s.config.setDefaults()
+	s.watchdogTimeout.Store(int64(s.config.watchdogTimeout()))
+
+	err := s.openDataDir()
 	if err != nil {
 		return err
 	}
 
-	s.stats, err = NewLocalJSONStore(s.config.DataDir)
+	s.weather, err = newWeatherProvider(s.config)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// openDataDir loads everything we keep in DataDir
+func (s *sprinkler) openDataDir() error {
+	err := os.MkdirAll(s.config.DataDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	if s.stats != nil {
+		err = s.stats.Close()
+		if err != nil {
+			s.logger.Warnf("cannot close old store %v", err)
+		}
+	}
+
+	s.stats, err = openStore(s.config.DataDir, s.config.Store, s.config.flushInterval(), s.logger)
+	if err != nil {
+		return err
+	}
+
+	s.balance, err = loadWaterBalance(s.config.DataDir, s.logger)
+	if err != nil {
+		return err
+	}
+
+	s.flowBaseline, err = loadFlowBaseline(s.config.DataDir, s.logger)
+	if err != nil {
+		return err
+	}
+
+	return s.loadState_inlock()
+}
+
 func (s *sprinkler) Name() resource.Name {
 	return s.name
 }
@@ -198,27 +743,62 @@ func (s *sprinkler) Status(ctx context.Context) (map[string]interface{}, error)
 }
 
 func (s *sprinkler) Close(ctx context.Context) error {
-	s.backgroundCancel()
+	if s.backgroundCancel != nil {
+		s.backgroundCancel()
+	}
+
+	// wait for the loop so it can't turn anything back on
+	if s.loopDone != nil {
+		select {
+		case <-s.loopDone:
+		case <-ctx.Done():
+		}
+	}
+
+	err := s.stopAllExcept(ctx, why{cause: causeShutdown})
+	if err != nil {
+		s.logger.Errorf("cannot turn all zones off on close: %v", err)
+	}
+
+	s.statsLock.Lock()
+	err = errors.Join(err, s.saveFlowBaseline_inlock(time.Now(), true))
+	s.statsLock.Unlock()
+
+	err = errors.Join(err, s.stats.Close())
+
 	if s.webServer != nil {
-		return s.webServer.Shutdown(ctx)
+		return errors.Join(err, s.webServer.Shutdown(ctx))
 	}
-	return nil
+	return err
 }
 
+const loopInterval = 10 * time.Second
+
 func (s *sprinkler) run() {
-	s.backgroundContext, s.backgroundCancel = context.WithCancel(context.Background())
+	defer close(s.loopDone)
 
 	for {
 		err := s.doLoop(s.backgroundContext, time.Now())
 		if err != nil {
 			s.logger.Errorf("error doing sprinkler loop: %v", err)
 		}
+		s.beat(time.Now())
 
-		if !utils.SelectContextOrWait(s.backgroundContext, 10*time.Second) {
+		select {
+		case <-s.backgroundContext.Done():
 			s.logger.Errorf("stopping sprinkler")
 			return
+		case <-time.After(loopInterval):
+		case <-s.wake:
 		}
+	}
+}
 
+// poke makes the loop go around now instead of waiting, after a command changed something
+func (s *sprinkler) poke() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
 	}
 }
 
@@ -229,7 +809,7 @@ const (
 	rainDidIt       = 4
 )
 
-func (s *sprinkler) doRainPrediction_inlock(now time.Time) (int, error) {
+func (s *sprinkler) doRainPrediction_inlock(ctx context.Context, now time.Time) (int, error) {
 	if now.Sub(s.lastRainCheck) < (time.Minute * 10) {
 		return rainTooSoon, nil
 	}
@@ -244,56 +824,295 @@ func (s *sprinkler) doRainPrediction_inlock(now time.Time) (int, error) {
 		return rainDone, nil
 	}
 
-	if s.config.Lat == "" || s.config.Long == "" {
+	if s.weather == nil && s.config.Station == "" && s.rainGauge == nil {
 		return rainNotConf, nil
 	}
 
-	rain, maxTempReal, err := rainPrediction(s.config.Lat, s.config.Long, 24)
+	observed, haveObserved, err := s.observedRain_inlock(now)
 	if err != nil {
-		return 0, err
+		s.logger.Warnf("cannot get observed rain %v", err)
 	}
 
-	fmt.Printf("weather rain: %v temp: %v\n", rain, maxTempReal)
+	haveForecast := s.weather != nil
+	w := weatherSummary{}
+	if haveForecast {
+		hourly, err := s.weather.Forecast(ctx)
+		if err != nil {
+			return 0, err
+		}
+		w = summarizeWeather(hourly, now, 24)
+		fmt.Printf("weather rain: %v temp: %v - %v\n", w.RainMM, w.MinTemp, w.MaxTemp)
 
-	tempAdjust := heatAdjustmentCelsiusExtraPercentage(maxTempReal)
+		if s.rainGauge != nil {
+			// we measure rain ourselves, so don't count on the forecast
+			w.RainMM = 0
+		}
 
+		err = s.updateWaterBalance_inlock(now, w, observed, haveObserved)
+		if err != nil {
+			return 0, err
+		}
+	}
+	rain, maxTempReal := w.RainMM, w.MaxTemp
+
+	if haveForecast || haveObserved {
+		err = s.stats.AddWeather(WeatherSnapshot{Time: now, RainMM: rain, ObservedMM: observed, MinTemp: w.MinTemp, MaxTemp: w.MaxTemp})
+		if err != nil {
+			s.logger.Warnf("cannot save weather %v", err)
+		}
+	}
+
+	tempAdjust := 0.0
+	if haveForecast {
+		tempAdjust = heatAdjustmentCelsiusExtraPercentage(maxTempReal)
+	}
+
+	// yesterday's forecast rain was already credited, only what fell on top of it is new
+	newRain := 0.0
+	if haveObserved {
+		forecast, err := s.forecastRain_inlock(now.AddDate(0, 0, -1))
+		if err != nil {
+			return 0, err
+		}
+		newRain = max(0, observed-forecast)
+	}
+
+	// the rain/20 and temperature rules are only for zones with fixed minutes,
+	// the water balance already counted rain and heat for the rest
 	for _, n := range s.config.zoneOrder() {
 		z := s.config.Zones[n]
+		if z.usesWaterBalance() {
+			continue
+		}
 
-		totalToAdd := time.Duration(0)
+		adj := map[string]time.Duration{}
 
 		if rain > 0 {
 			toAdd := time.Duration(float64(time.Minute) * float64(z.Minutes) * rain / 20)
-			totalToAdd += toAdd
+			adj[adjustRain] += toAdd
 			fmt.Printf("remove %v to zone %v because it rained (%v)\n", toAdd.Round(time.Second), n, rain)
 		}
 
+		if newRain > 0 {
+			toAdd := time.Duration(float64(time.Minute) * float64(z.Minutes) * newRain / 20)
+			adj[adjustRain] += toAdd
+			fmt.Printf("remove %v to zone %v because it actually rained (%v)\n", toAdd.Round(time.Second), n, newRain)
+		}
+
 		if tempAdjust > 0 {
 			toAdd := time.Duration(tempAdjust * float64(z.Minutes) * float64(time.Minute))
-			totalToAdd -= toAdd
+			adj[adjustHeat] += toAdd
 			fmt.Printf("adding %v to zone %v because it's hot (%v)\n", toAdd.Round(time.Second), n, maxTempReal)
 		}
 
 		if tempAdjust < 0 {
-			toAdd := time.Duration(tempAdjust * float64(z.Minutes) * float64(time.Minute))
-			totalToAdd -= toAdd
-			fmt.Printf("adding %v to zone %v because it's cold (%v)\n", toAdd.Round(time.Second), n, maxTempReal)
+			toAdd := time.Duration(-tempAdjust * float64(z.Minutes) * float64(time.Minute))
+			adj[adjustCold] += toAdd
+			fmt.Printf("removing %v from zone %v because it's cold (%v)\n", toAdd.Round(time.Second), n, maxTempReal)
+		}
+
+		for _, kind := range []string{adjustRain, adjustHeat, adjustCold} {
+			if adj[kind] == 0 {
+				continue
+			}
+			_, err = s.stats.AddAdjustment(n, kind, now, adj[kind])
+			if err != nil {
+				return 0, err
+			}
+		}
+		credit := ledger{Rain: adj[adjustRain], Heat: adj[adjustHeat], Cold: adj[adjustCold]}.credit()
+
+		if credit != 0 {
+			s.record(Event{
+				Time:    now,
+				Zone:    n,
+				Cause:   causeWeather,
+				Detail:  fmt.Sprintf("rain %0.1f observed %0.1f max temp %0.1f", rain, observed, maxTempReal),
+				Minutes: credit.Minutes(),
+			})
 		}
 
-		_, err = s.stats.AddWatered(n, now, totalToAdd)
+	}
+
+	if haveObserved {
+		_, err = s.stats.AddWatered("rain_observed", now, time.Duration(observed*float64(time.Minute)))
 		if err != nil {
 			return 0, err
 		}
-
 	}
 
 	s.stats.AddWatered("rain_sensor", now, time.Second+time.Duration(rain*float64(time.Minute)))
 	return rainDidIt, nil
 }
 
+// observedRain_inlock is the mm of rain that actually fell in the last 24 hours, if we know
+func (s *sprinkler) observedRain_inlock(now time.Time) (float64, bool, error) {
+	if s.rainGauge != nil {
+		// a gauge in the yard beats a station miles away
+		d, err := s.stats.AmountWatered("rain", now.AddDate(0, 0, -1))
+		if err != nil {
+			return 0, false, err
+		}
+		return d.Minutes(), true, nil
+	}
+
+	if s.config.Station == "" {
+		return 0, false, nil
+	}
+
+	r, err := s.rainCache.rain(s.config.Station, 24, now)
+	if err != nil {
+		return 0, false, err
+	}
+	return r, true, nil
+}
+
+// forecastRain_inlock is the forecast rain we credited on day, from the last weather snapshot
+func (s *sprinkler) forecastRain_inlock(day time.Time) (float64, error) {
+	all, err := s.stats.Weather(startOfDay(day), startOfDay(day).AddDate(0, 0, 1).Add(-time.Nanosecond))
+	if err != nil {
+		return 0, err
+	}
+	if len(all) == 0 {
+		return 0, nil
+	}
+	return all[len(all)-1].RainMM, nil
+}
+
+// why we're suspended, in Readings as suspended
+const (
+	suspendFreeze      = "freeze sensor"
+	suspendRain        = "rain sensor"
+	suspendSensorError = "sensor error"
+)
+
+// suspendReason returns which sensor switch is open, if any
+func (s *sprinkler) suspendReason(ctx context.Context) (string, error) {
+	sensors := []struct {
+		name string
+		pin  board.GPIOPin
+	}{
+		{suspendFreeze, s.freezeSensor},
+		{suspendRain, s.rainSensor},
+	}
+
+	for _, x := range sensors {
+		if x.pin == nil {
+			continue
+		}
+		closed, err := x.pin.Get(ctx, nil)
+		if err != nil {
+			return "", fmt.Errorf("cannot read %s: %w", x.name, err)
+		}
+		if !closed {
+			return x.name, nil
+		}
+	}
+	return "", nil
+}
+
+// readFlowMeter_inlock splits the water used since last time between the zones that were running
+func (s *sprinkler) readFlowMeter_inlock(ctx context.Context, now time.Time) error {
+	if s.flowMeter == nil {
+		return nil
+	}
+
+	pulses, err := s.flowMeter.Value(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	prev, havePrev, prevTime := s.flowMeterPulses, s.flowMeterHavePulse, s.flowMeterTime
+	s.flowMeterPulses, s.flowMeterHavePulse, s.flowMeterTime = pulses, true, now
+
+	if !havePrev || pulses <= prev {
+		return nil
+	}
+
+	liters := float64(pulses-prev) / s.config.FlowMeterPulsesPerLiter
+
+	if minutes := now.Sub(prevTime).Minutes(); minutes > 0 {
+		err = s.checkFlow_inlock(liters/minutes, prevTime, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(s.running) == 0 {
+		s.logger.Warnf("%0.2f liters of water used with no zone running", liters)
+		_, err = s.stats.AddVolume(unassignedVolume, now, liters)
+		return err
+	}
+
+	shares, _ := s.config.flowShares(s.running)
+	for _, z := range s.running {
+		_, err = s.stats.AddVolume(z, now, liters*shares[z])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flowShares is how much of the water each zone uses by its flow, false and split evenly if we don't know
+func (cfg sprinklerConfig) flowShares(zones []string) (map[string]float64, bool) {
+	totalFlow := 0.0
+	for _, z := range zones {
+		if f := cfg.Zones[z].Flow; f > 0 {
+			totalFlow += f
+		} else {
+			totalFlow = 0
+			break
+		}
+	}
+
+	shares := map[string]float64{}
+	for _, z := range zones {
+		if totalFlow > 0 {
+			shares[z] = cfg.Zones[z].Flow / totalFlow
+		} else {
+			shares[z] = 1 / float64(len(zones))
+		}
+	}
+	return shares, totalFlow > 0
+}
+
+// unassignedVolume is where water goes when no zone was running
+const unassignedVolume = "unassigned"
+
+// DefaultRainGaugeMMPerTick is what most tipping bucket gauges do, 0.011"
+const DefaultRainGaugeMMPerTick = 0.2794
+
+// readRainGauge_inlock counts the ticks since last time into "rain", in mm
+func (s *sprinkler) readRainGauge_inlock(ctx context.Context, now time.Time) error {
+	if s.rainGauge == nil {
+		return nil
+	}
+
+	ticks, err := s.rainGauge.Value(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	prev, havePrev := s.rainGaugeTicks, s.rainGaugeHaveTick
+	s.rainGaugeTicks, s.rainGaugeHaveTick = ticks, true
+
+	// the first read is just where we start, and if the counter went backwards the board restarted
+	if !havePrev || ticks <= prev {
+		return nil
+	}
+
+	mm := float64(ticks-prev) * s.config.RainGaugeMMPerTick
+	_, err = s.stats.AddWatered("rain", now, time.Duration(mm*float64(time.Minute)))
+	return err
+}
+
 // returns 0 -> some number
 const FlatCelsius = 22.0
 
+// maxHeatExtra is the most heat can add, as a fraction of the zone's minutes
+const maxHeatExtra = 2.0
+
 func heatAdjustmentCelsiusExtraPercentage(temp float64) float64 {
 	adjust := temp - FlatCelsius
 	if adjust == 0 {
@@ -301,7 +1120,7 @@ func heatAdjustmentCelsiusExtraPercentage(temp float64) float64 {
 	}
 
 	if adjust > 0 { // it's hot
-		return min(adjust/6, 2)
+		return min(adjust/6, maxHeatExtra)
 	}
 
 	return adjust / 15
@@ -311,84 +1130,238 @@ func (s *sprinkler) doLoop(ctx context.Context, now time.Time) error {
 
 	s.statsLock.Lock()
 
-	if s.running != "" { // note: this has to be first
+	for _, z := range s.running { // note: this has to be first
 		amount := now.Sub(s.lastLoop)
-		total, err := s.stats.AddWatered(s.running, now, amount)
+		total, err := s.stats.AddWatered(z, now, amount)
 		if err != nil {
+			s.statsLock.Unlock()
 			return err
 		}
-		fmt.Printf("adding %v to %v, now at : %v\n", amount.Round(time.Second), s.running, total.Round(time.Second))
+		fmt.Printf("adding %v to %v, now at : %v\n", amount.Round(time.Second), z, total.Round(time.Second))
 
 	}
 	s.lastLoop = now
 
-	_, err := s.doRainPrediction_inlock(now)
+	err := s.readFlowMeter_inlock(ctx, now)
+	if err != nil {
+		s.logger.Warnf("cannot read flow meter %v", err)
+	}
+
+	err = s.readRainGauge_inlock(ctx, now)
+	if err != nil {
+		s.logger.Warnf("cannot read rain gauge %v", err)
+	}
+
+	_, err = s.doRainPrediction_inlock(ctx, now)
 	if err != nil {
 		s.logger.Warnf("cannot do rain prediction %v", err)
 	}
 
-	if now.Before(s.forceTill) && s.forceZone != "" {
+	s.checkMaxRun_inlock(now)
+
+	s.suspended, err = s.suspendReason(ctx)
+	if err != nil {
+		// if we can't tell if it's raining or freezing, don't water
+		s.logger.Warnf("cannot read sensors %v", err)
+		s.suspended = suspendSensorError
+	}
+
+	// running a zone by hand in the rain is fine, in a freeze it isn't
+	forceOK := s.suspended == "" || s.suspended == suspendRain
+	if forceOK && now.Before(s.forceTill) && s.forceZone != "" && s.faults[s.forceZone] == "" {
 		z := s.forceZone
-		s.running = s.forceZone
+		s.setRunning_inlock([]string{z}, now)
+		w := s.why_inlock(now, causeForce, fmt.Sprintf("till %v", s.forceTill.Format(time.Kitchen)))
 		s.statsLock.Unlock()
 
 		s.logger.Infof("forcing zone %s till %v", z, s.forceTill)
-		return s.stopAllExcept(ctx, z)
+		return s.stopAllExcept(ctx, w, z)
+	}
+
+	if s.suspended != "" {
+		reason := s.suspended
+		s.setRunning_inlock(nil, now)
+		w := s.why_inlock(now, causePause, "suspended because of the "+reason)
+		s.statsLock.Unlock()
+		s.logger.Infof("suspended because of the %s", reason)
+		return s.stopAllExcept(ctx, w)
 	}
 
 	if now.Before(s.pauseTillTime) {
-		s.running = ""
+		s.setRunning_inlock(nil, now)
+		w := s.why_inlock(now, causePause, fmt.Sprintf("till %v", s.pauseTillTime.Format(time.Kitchen)))
 		s.statsLock.Unlock()
 		s.logger.Infof("paused till %v", s.pauseTillTime)
-		return s.stopAllExcept(ctx, "")
+		return s.stopAllExcept(ctx, w)
 	}
 
-	startMinuteOfDay := s.config.StartHour*60 + s.config.StartMinute
-	if s.config.StartHour >= 0 && (now.Hour()*60+now.Minute()) < startMinuteOfDay {
-		s.running = ""
+	if !s.config.inWindow(now) {
+		s.setRunning_inlock(nil, now)
 		s.lastLoop = now
+		w := s.why_inlock(now, causeSchedule, "outside the watering window")
 		s.statsLock.Unlock()
-		return s.stopAllExcept(ctx, "")
+		return s.stopAllExcept(ctx, w)
 	}
 
 	prev := s.running
-	s.running = s.pickNext_inlock(now)
+	s.setRunning_inlock(s.pickNext_inlock(now), now)
+	running := s.running
+	w := s.why_inlock(now, causeSchedule, "")
 	s.statsLock.Unlock()
 
-	if prev == s.running {
+	// if the watchdog turned everything off, the valves don't match prev anymore
+	if slices.Equal(prev, running) && !s.watchdogTripped.Swap(false) {
 		return nil
 	}
 
-	return s.stopAllExcept(ctx, s.running)
+	return s.stopAllExcept(ctx, w, running...)
+}
+
+// setRunning_inlock keeps track of when zones start and stop so we can do cycle and soak
+func (s *sprinkler) setRunning_inlock(zones []string, now time.Time) {
+	stopped := false
+	for _, z := range s.running {
+		if !slices.Contains(zones, z) {
+			stopped = true
+			if s.onTooLong_inlock(z, now.Add(loopInterval)) {
+				// it hit its max run, so it has to be off as long before it can go again
+				s.restTill[z] = now.Add(s.config.maxRun(z))
+			}
+			s.lastStopped[z] = now
+			delete(s.runningSince, z)
+			delete(s.onSince, z)
+		}
+	}
+
+	if stopped {
+		err := s.saveFlowBaseline_inlock(now, true)
+		if err != nil {
+			s.logger.Warnf("cannot save flow baseline %v", err)
+		}
+	}
+
+	for _, z := range zones {
+		if !slices.Contains(s.running, z) {
+			s.onSince[z] = now
+		}
+		if !slices.Contains(s.running, z) || s.sliceDone_inlock(z, now) {
+			// either it's starting, or nothing else could go, so this is a new slice for the same zone
+			s.runningSince[z] = now
+		}
+	}
+
+	s.running = zones
+}
+
+func (s *sprinkler) isRunning_inlock(zone string) bool {
+	return slices.Contains(s.running, zone)
+}
+
+func (s *sprinkler) sliceDone_inlock(zone string, now time.Time) bool {
+	slice := s.config.timeSlice(zone)
+	return slice > 0 && now.Sub(s.runningSince[zone]) >= slice
+}
+
+func (s *sprinkler) soaking_inlock(zone string, now time.Time) bool {
+	stopped, ok := s.lastStopped[zone]
+	if !ok {
+		return false
+	}
+	return now.Sub(stopped) < s.config.soakTime(zone)
+}
+
+// targetMinutes_inlock is how long we want to water a zone today
+func (s *sprinkler) targetMinutes_inlock(zone string, now time.Time) float64 {
+	z := s.config.Zones[zone]
+	if !z.usesWaterBalance() {
+		return float64(z.Minutes)
+	}
+	if s.balance.Day != dayString(now) {
+		// we haven't gotten weather today, so we don't know how dry it is
+		return 0
+	}
+	return s.balance.Target[zone]
+}
+
+func (s *sprinkler) needsWater_inlock(zone string, now time.Time) bool {
+	if s.faults[zone] != "" || now.Before(s.holdTill[zone]) {
+		return false
+	}
+
+	target := s.targetMinutes_inlock(zone, now)
+	if target <= 0 {
+		return false
+	}
+
+	l, err := s.ledger_inlock(zone, now)
+	if err != nil {
+		// if we can't tell how much it got, don't risk flooding it
+		s.logger.Errorf("cannot tell how long zone %s has run, skipping it: %v", zone, err)
+		return false
+	}
+
+	return s.effectiveTarget_inlock(zone, now, l) >= l.Ran.Minutes()
 }
 
-func (s *sprinkler) pickNext_inlock(now time.Time) string {
+// pickNext_inlock picks what zones should run now. Without max_flow only one
+// zone runs at a time, with it as many as fit in the flow budget.
+func (s *sprinkler) pickNext_inlock(now time.Time) []string {
 
 	if s.config.SkipDay(now) {
-		return ""
+		return nil
 	}
 
-	names := s.config.zoneOrder()
-	for _, n := range names {
-		z := s.config.Zones[n]
-		d, err := s.stats.AmountWatered(n, now)
-		if err != nil {
-			panic(err)
+	picked := []string{}
+	flow := 0.0
+	fits := func(zone string) bool {
+		if len(picked) == 0 {
+			return true
 		}
+		return s.config.MaxFlow > 0 && flow+s.config.Zones[zone].Flow <= s.config.MaxFlow
+	}
+	add := func(zone string) {
+		picked = append(picked, zone)
+		flow += s.config.Zones[zone].Flow
+	}
 
-		min := float64(z.Minutes)
+	order := s.config.zoneOrder()
 
-		if min >= d.Minutes() {
-			return n
+	// first, whatever is running keeps going until its slice is used up
+	for _, n := range order {
+		if s.isRunning_inlock(n) && s.needsWater_inlock(n, now) && !s.sliceDone_inlock(n, now) && !s.onTooLong_inlock(n, now.Add(loopInterval)) && fits(n) {
+			add(n)
 		}
 	}
 
-	return ""
+	for _, n := range order {
+		if s.isRunning_inlock(n) {
+			continue
+		}
+		if s.needsWater_inlock(n, now) && !s.soaking_inlock(n, now) && !now.Before(s.restTill[n]) && fits(n) {
+			add(n)
+		}
+	}
+
+	// if there is still room, keep going if we don't have to soak
+	for _, n := range order {
+		if slices.Contains(picked, n) || !s.isRunning_inlock(n) {
+			continue
+		}
+		if s.config.soakTime(n) == 0 && s.needsWater_inlock(n, now) && !s.onTooLong_inlock(n, now.Add(loopInterval)) && fits(n) {
+			add(n)
+		}
+	}
+
+	// keep the order stable so we can tell if anything changed
+	sort.Slice(picked, func(i, j int) bool { return slices.Index(order, picked[i]) < slices.Index(order, picked[j]) })
+	return picked
 }
 
 func (s *sprinkler) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
 	cmdName := cmd["cmd"]
 	if cmdName == "order" {
+		s.statsLock.Lock()
+		defer s.statsLock.Unlock()
 		return map[string]interface{}{"order": s.config.zoneOrder()}, nil
 	}
 
@@ -400,8 +1373,9 @@ func (s *sprinkler) DoCommand(ctx context.Context, cmd map[string]interface{}) (
 		t := time.Now().Add(time.Duration(float64(time.Minute) * min))
 		s.statsLock.Lock()
 		s.pauseTillTime = t
+		err := s.saveState_inlock()
 		s.statsLock.Unlock()
-		return map[string]interface{}{"till": t}, nil
+		return map[string]interface{}{"till": t}, err
 	}
 
 	if cmdName == "run" {
@@ -416,11 +1390,48 @@ func (s *sprinkler) DoCommand(ctx context.Context, cmd map[string]interface{}) (
 		}
 
 		s.statsLock.Lock()
-		s.forceZone = z
-		s.forceTill = t
+		fault := s.faults[z]
+		var err error
+		if fault == "" {
+			s.forceZone = z
+			s.forceTill = t
+			delete(s.holdTill, z)
+			err = s.saveState_inlock()
+		}
 		s.statsLock.Unlock()
 
-		return map[string]interface{}{"till": t}, nil
+		if fault != "" {
+			return nil, fmt.Errorf("zone %s is faulted (%s), clear it first", z, fault)
+		}
+		s.poke()
+
+		return map[string]interface{}{"till": t}, err
+	}
+
+	if cmdName == "stop" {
+		z, ok := cmd["zone"].(string)
+		if !ok {
+			return nil, fmt.Errorf("zone isn't a string")
+		}
+
+		// it stays off for the rest of the day unless someone runs it again
+		now := time.Now()
+		t := startOfDay(now).AddDate(0, 0, 1)
+
+		s.statsLock.Lock()
+		if _, ok := s.config.Zones[z]; !ok {
+			s.statsLock.Unlock()
+			return nil, fmt.Errorf("no zone [%s]", z)
+		}
+		if s.forceZone == z {
+			s.forceZone = ""
+		}
+		s.holdTill[z] = t
+		err := s.saveState_inlock()
+		s.statsLock.Unlock()
+
+		s.poke()
+		return map[string]interface{}{"till": t}, err
 	}
 
 	if cmdName == "markZoneTime" {
@@ -428,19 +1439,51 @@ func (s *sprinkler) DoCommand(ctx context.Context, cmd map[string]interface{}) (
 		if !ok {
 			return nil, fmt.Errorf("pause command requires a 'minutes' param that is an float64, got [%v] an %T", cmd["minutes"], cmd["minutes"])
 		}
+		// marking less than nothing would make the zone water more
+		if min < 0 || math.IsNaN(min) || math.IsInf(min, 0) {
+			return nil, fmt.Errorf("markZoneTime minutes has to be a finite number, 0 or more, got [%v]", min)
+		}
 
 		z, ok := cmd["zone"].(string)
 		if !ok {
 			return nil, fmt.Errorf("zone isn't a string")
 		}
 
+		now := time.Now()
 		s.statsLock.Lock()
-		_, err := s.stats.AddWatered(z, time.Now(), time.Duration((float64(time.Minute) * min)))
+		_, err := s.stats.AddAdjustment(z, adjustMark, now, time.Duration((float64(time.Minute) * min)))
+		if err == nil {
+			s.record(Event{Time: now, Zone: z, Cause: causeMark, Minutes: min})
+		}
 		s.statsLock.Unlock()
 
 		return map[string]interface{}{}, err
 	}
 
+	if cmdName == "clearFault" {
+		z, ok := cmd["zone"].(string)
+		if !ok {
+			return nil, fmt.Errorf("zone isn't a string")
+		}
+
+		s.statsLock.Lock()
+		defer s.statsLock.Unlock()
+		delete(s.faults, z)
+		return map[string]interface{}{}, s.saveState_inlock()
+	}
+
+	if cmdName == "clearAlert" {
+		// only dismisses the message, zones stay faulted till their fault is cleared
+		s.statsLock.Lock()
+		s.alert = ""
+		s.statsLock.Unlock()
+		return map[string]interface{}{}, nil
+	}
+
+	if cmdName == "history" {
+		return s.history(cmd)
+	}
+
 	return nil, fmt.Errorf("sprinkler do command doesn't understand cmd [%s]", cmdName)
 }
 
@@ -453,14 +1496,54 @@ func (s *sprinkler) Readings(ctx context.Context, extra map[string]interface{})
 	defer s.statsLock.Unlock()
 
 	for _, n := range s.config.zoneOrder() {
-		v, err := s.stats.AmountWatered(n, now)
+		l, err := s.ledger_inlock(n, now)
 		if err != nil {
 			return nil, err
 		}
-		m[n] = v.Minutes()
-		m[fmt.Sprintf("%s-configured", n)] = s.config.Zones[n].Minutes
+		m[n] = l.Ran.Minutes()
+		m[fmt.Sprintf("%s-rain-minutes", n)] = l.Rain.Minutes()
+		m[fmt.Sprintf("%s-heat-minutes", n)] = l.Heat.Minutes()
+		m[fmt.Sprintf("%s-cold-minutes", n)] = l.Cold.Minutes()
+		m[fmt.Sprintf("%s-marked-minutes", n)] = l.Mark.Minutes()
+		m[fmt.Sprintf("%s-target", n)] = s.effectiveTarget_inlock(n, now, l)
+		if s.config.Zones[n].usesWaterBalance() {
+			m[fmt.Sprintf("%s-configured", n)] = s.targetMinutes_inlock(n, now)
+			m[fmt.Sprintf("%s-depletion-mm", n)] = s.balance.Depletion[n]
+		} else {
+			m[fmt.Sprintf("%s-configured", n)] = s.config.Zones[n].Minutes
+		}
+		m[fmt.Sprintf("%s-fault", n)] = s.faults[n]
+		m[fmt.Sprintf("%s-pin-faults", n)] = s.pinFaultCount(n)
 	}
-	m["running"] = s.running
+	if s.flowMeter != nil {
+		for _, n := range append(s.config.zoneOrder(), unassignedVolume) {
+			day, err := s.stats.VolumeUsed(n, now, now)
+			if err != nil {
+				return nil, err
+			}
+			week, err := s.stats.VolumeUsed(n, startOfWeek(now), now)
+			if err != nil {
+				return nil, err
+			}
+			month, err := s.stats.VolumeUsed(n, startOfMonth(now), now)
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprintf("%s-liters", n)] = day
+			m[fmt.Sprintf("%s-liters-week", n)] = week
+			m[fmt.Sprintf("%s-liters-month", n)] = month
+			if f, ok := s.flowBaseline[n]; ok {
+				m[fmt.Sprintf("%s-normal-liters-per-minute", n)] = f.LitersPerMinute
+			}
+		}
+	}
+
+	m["running"] = strings.Join(s.running, ", ")
+	runningZones := []interface{}{}
+	for _, z := range s.running {
+		runningZones = append(runningZones, z)
+	}
+	m["running_zones"] = runningZones
 
 	if time.Now().Before(s.pauseTillTime) {
 		m["pause_till"] = s.pauseTillTime.Format(time.UnixDate)
@@ -468,6 +1551,12 @@ func (s *sprinkler) Readings(ctx context.Context, extra map[string]interface{})
 		m["pause_till"] = ""
 	}
 
+	m["suspended"] = s.suspended
+	m["alert"] = s.alert
+	if s.masterPin != nil {
+		m["master-pin-faults"] = s.pinFaultCount(masterPinName)
+	}
+
 	m["force_zone"] = s.forceZone
 	m["force_till"] = s.forceTill.Format(time.UnixDate)
 
@@ -477,54 +1566,123 @@ func (s *sprinkler) Readings(ctx context.Context, extra map[string]interface{})
 	}
 	m["rain"] = v.Minutes()
 
+	v, err = s.stats.AmountWatered("rain_observed", now)
+	if err != nil {
+		return nil, err
+	}
+	m["rain_observed_mm"] = v.Minutes()
+
 	return m, nil
 }
 
-func (s *sprinkler) stopAllExcept(ctx context.Context, torun string) error {
-	for name := range s.pins {
-		if name == torun {
-			err := s.zoneOn(ctx, name)
+func (s *sprinkler) stopAllExcept(ctx context.Context, w why, torun ...string) error {
+	s.valveLock.Lock()
+	defer s.valveLock.Unlock()
+	return s.setValves(ctx, w, torun...)
+}
+
+// setValves opens the zones in torun and closes the rest, valveLock has to be held
+func (s *sprinkler) setValves(ctx context.Context, w why, torun ...string) error {
+	var errs []error
+
+	if len(torun) > 0 {
+		err := s.masterOn(ctx)
+		if err != nil {
+			// no point opening zones with no water, but still close everything else
+			errs = append(errs, err)
+			torun = nil
+		}
+	}
+
+	// keep going on errors, one bad relay shouldn't leave the others on
+	for name := range s.valves {
+		if slices.Contains(torun, name) {
+			err := s.zoneOn(ctx, name, w)
 			if err != nil {
-				return fmt.Errorf("cannot turn on pin (%s) for zone (%s)", s.config.Zones[name].Pin, name)
+				errs = append(errs, fmt.Errorf("cannot turn on zone (%s): %w", name, err))
 			}
 		} else {
-			err := s.zoneOff(ctx, name)
+			err := s.zoneOff(ctx, name, w)
 			if err != nil {
-				return fmt.Errorf("cannot turn off pin (%s) for zone (%s)", s.config.Zones[name].Pin, name)
+				errs = append(errs, fmt.Errorf("cannot turn off zone (%s): %w", name, err))
 			}
 		}
 	}
-	return nil
+
+	if len(torun) == 0 {
+		errs = append(errs, s.masterOff(ctx))
+	}
+	return errors.Join(errs...)
 }
 
-func (s *sprinkler) zoneOn(ctx context.Context, zone string) error {
-	p, ok := s.pins[zone]
-	if !ok {
-		return fmt.Errorf("why no pin for zone: %s", zone)
+// masterOn turns on the master valve, and gives it time to pressurize before any zone opens
+func (s *sprinkler) masterOn(ctx context.Context) error {
+	if s.masterPin == nil {
+		return nil
 	}
-	v, err := p.Get(ctx, nil)
+	v, err := s.masterPin.Get(ctx, nil)
 	if err != nil {
-		return err
+		return fmt.Errorf("cannot read master pin (%s): %w", s.config.MasterPin, err)
 	}
-	if v == true {
+	if v == !s.config.ActiveLow {
 		return nil
 	}
-	s.logger.Infof("turning zone on %s", zone)
-	return p.Set(ctx, true, nil)
+
+	s.logger.Infof("turning master on")
+	err = s.setPin(ctx, masterPinName, s.masterPin, !s.config.ActiveLow)
+	if err != nil {
+		return fmt.Errorf("cannot turn on master pin (%s): %w", s.config.MasterPin, err)
+	}
+
+	utils.SelectContextOrWait(ctx, time.Duration(s.config.MasterPreOpenSeconds*float64(time.Second)))
+	return nil
 }
 
-func (s *sprinkler) zoneOff(ctx context.Context, zone string) error {
-	p, ok := s.pins[zone]
-	if !ok {
-		return fmt.Errorf("why no pin for zone: %s", zone)
+// masterOff turns off the master valve a little after the zones closed
+func (s *sprinkler) masterOff(ctx context.Context) error {
+	if s.masterPin == nil {
+		return nil
 	}
-	v, err := p.Get(ctx, nil)
+	v, err := s.masterPin.Get(ctx, nil)
 	if err != nil {
-		return err
+		return fmt.Errorf("cannot read master pin (%s): %w", s.config.MasterPin, err)
 	}
-	if v == false {
+	if v == s.config.ActiveLow {
 		return nil
 	}
-	s.logger.Infof("turning zone off %s", zone)
-	return p.Set(ctx, false, nil)
+
+	utils.SelectContextOrWait(ctx, time.Duration(s.config.MasterPostCloseSeconds*float64(time.Second)))
+
+	s.logger.Infof("turning master off")
+	err = s.setPin(ctx, masterPinName, s.masterPin, s.config.ActiveLow)
+	if err != nil {
+		return fmt.Errorf("cannot turn off master pin (%s): %w", s.config.MasterPin, err)
+	}
+	return nil
+}
+
+func (s *sprinkler) zoneOn(ctx context.Context, zone string, w why) error {
+	v, ok := s.valves[zone]
+	if !ok {
+		return fmt.Errorf("why no valve for zone: %s", zone)
+	}
+	changed, err := v.set(ctx, true)
+	if changed {
+		s.logger.Infof("turned zone on %s", zone)
+		s.recordValve(zone, true, w)
+	}
+	return err
+}
+
+func (s *sprinkler) zoneOff(ctx context.Context, zone string, w why) error {
+	v, ok := s.valves[zone]
+	if !ok {
+		return fmt.Errorf("why no valve for zone: %s", zone)
+	}
+	changed, err := v.set(ctx, false)
+	if changed {
+		s.logger.Infof("turned zone off %s", zone)
+		s.recordValve(zone, false, w)
+	}
+	return err
 }
@@ -2,6 +2,7 @@ package sprinkler
 
 import (
 	"context"
+	"errors"
 	"os"
 	"testing"
 	"time"
@@ -9,6 +10,7 @@ import (
 	"go.viam.com/rdk/components/board"
 	"go.viam.com/rdk/components/board/fake"
 	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
 
 	"go.viam.com/test"
 )
@@ -29,18 +31,25 @@ func addDummyPins(s *sprinkler) func() {
 	}
 	s.config.DataDir = dir
 	s.init()
-	s.pins = map[string]board.GPIOPin{}
 	for n := range s.config.Zones {
-		s.pins[n] = &fake.GPIOPin{}
+		s.valves[n] = &levelValve{s: s, zone: n, pin: &fake.GPIOPin{}}
 	}
-	return func() { os.RemoveAll(dir) }
+	return func() {
+		s.stats.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// zonePin is the fake pin behind a zone from addDummyPins
+func zonePin(s *sprinkler, zone string) board.GPIOPin {
+	return s.valves[zone].(*levelValve).pin
 }
 
 func TestPickNext(t *testing.T) {
 	s := sprinkler{config: &testSimpleConfig}
 	f := addDummyPins(&s)
 	defer f()
-	test.That(t, s.pickNext_inlock(time.Now()), test.ShouldEqual, "b")
+	test.That(t, s.pickNext_inlock(time.Now()), test.ShouldResemble, []string{"b"})
 }
 
 func TestLoop1(t *testing.T) {
@@ -51,11 +60,11 @@ func TestLoop1(t *testing.T) {
 
 	now := time.Now()
 	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
-	test.That(t, "b", test.ShouldEqual, s.running)
+	test.That(t, s.running, test.ShouldResemble, []string{"b"})
 
 	now = now.Add(time.Minute)
 	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
-	test.That(t, "b", test.ShouldEqual, s.running)
+	test.That(t, s.running, test.ShouldResemble, []string{"b"})
 	d, _ := s.stats.AmountWatered("b", now)
 	test.That(t, time.Minute, test.ShouldAlmostEqual, d)
 
@@ -63,7 +72,7 @@ func TestLoop1(t *testing.T) {
 	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
 	d, _ = s.stats.AmountWatered("b", now)
 	test.That(t, 21*time.Minute, test.ShouldAlmostEqual, d)
-	test.That(t, "a", test.ShouldEqual, s.running)
+	test.That(t, s.running, test.ShouldResemble, []string{"a"})
 
 }
 
@@ -92,33 +101,37 @@ func TestOrder(t *testing.T) {
 }
 
 func TestRainFull(t *testing.T) {
+	ctx := context.Background()
 	s := sprinkler{config: &testSimpleConfig}
 	f := addDummyPins(&s)
 	defer f()
 
-	now := time.Now()
+	now := time.Date(2026, time.June, 18, 0, 15, 0, 0, time.UTC)
 
-	mode, err := s.doRainPrediction_inlock(now)
+	mode, err := s.doRainPrediction_inlock(ctx, now)
 	test.That(t, err, test.ShouldBeNil)
 	test.That(t, mode, test.ShouldEqual, rainNotConf)
 
-	mode, err = s.doRainPrediction_inlock(now)
+	mode, err = s.doRainPrediction_inlock(ctx, now)
 	test.That(t, err, test.ShouldBeNil)
 	test.That(t, mode, test.ShouldEqual, rainTooSoon)
 
 	s.lastRainCheck = time.UnixMilli(0)
-	s.config.Lat = rainMagic
-	s.config.Long = rainMagic
+	s.weather = &fileWeather{fn: "testdata/forecast.json"} // 5mm of rain, 26C
 
-	mode, err = s.doRainPrediction_inlock(now)
+	mode, err = s.doRainPrediction_inlock(ctx, now)
 	test.That(t, err, test.ShouldBeNil)
 	test.That(t, mode, test.ShouldEqual, rainDidIt)
 
-	d, _ := s.stats.AmountWatered("b", now)
-	test.That(t, d/time.Minute, test.ShouldBeLessThan, 0)
+	// it's hot enough to need more than the rain makes up for, but none of it is run time
+	l, err := s.ledger_inlock("b", now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, l.credit()/time.Minute, test.ShouldBeLessThan, 0)
+	test.That(t, l.Ran, test.ShouldEqual, 0)
+	test.That(t, s.effectiveTarget_inlock("b", now, l), test.ShouldBeGreaterThan, 20)
 
 	s.lastRainCheck = time.UnixMilli(0)
-	mode, err = s.doRainPrediction_inlock(now)
+	mode, err = s.doRainPrediction_inlock(ctx, now)
 	test.That(t, err, test.ShouldBeNil)
 	test.That(t, mode, test.ShouldEqual, rainDone)
 
@@ -187,11 +200,11 @@ func TestStartTime(t *testing.T) {
 
 		// 00:10 is before the start time -> nothing runs.
 		test.That(t, s.doLoop(ctx, day.Add(10*time.Minute)), test.ShouldBeNil)
-		test.That(t, s.running, test.ShouldEqual, "")
+		test.That(t, s.running, test.ShouldBeEmpty)
 
 		// 00:20 is after the start time -> a zone runs.
 		test.That(t, s.doLoop(ctx, day.Add(20*time.Minute)), test.ShouldBeNil)
-		test.That(t, s.running, test.ShouldEqual, "b")
+		test.That(t, s.running, test.ShouldResemble, []string{"b"})
 	})
 
 	// An explicit start time gates with minute resolution.
@@ -212,10 +225,534 @@ func TestStartTime(t *testing.T) {
 
 		// 06:29 is before the start time -> nothing runs.
 		test.That(t, s.doLoop(ctx, day.Add(6*time.Hour+29*time.Minute)), test.ShouldBeNil)
-		test.That(t, s.running, test.ShouldEqual, "")
+		test.That(t, s.running, test.ShouldBeEmpty)
 
 		// 06:30 is the start time -> a zone runs.
 		test.That(t, s.doLoop(ctx, day.Add(6*time.Hour+30*time.Minute)), test.ShouldBeNil)
-		test.That(t, s.running, test.ShouldEqual, "b")
+		test.That(t, s.running, test.ShouldResemble, []string{"b"})
 	})
 }
+
+func TestCycleAndSoak(t *testing.T) {
+	ctx := context.Background()
+	s := sprinkler{
+		config: &sprinklerConfig{
+			StartHour:           -1,
+			MaxTimeSliceMinutes: 15,
+			MinSoakMinutes:      30,
+			Zones: map[string]ZoneConfig{
+				"a": {Minutes: 10},
+				"b": {Minutes: 20},
+				"c": {Minutes: 5, MinSoakMinutes: 5},
+			},
+		},
+		logger: logging.NewTestLogger(t),
+	}
+	f := addDummyPins(&s)
+	defer f()
+
+	now := time.Date(2026, time.June, 18, 4, 0, 0, 0, time.UTC)
+	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldResemble, []string{"b"})
+
+	// b used up its slice, rotate to the next zone
+	now = now.Add(15 * time.Minute)
+	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldResemble, []string{"a"})
+
+	now = now.Add(11 * time.Minute)
+	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldResemble, []string{"c"})
+
+	// b still needs 5 minutes, but is soaking
+	now = now.Add(6 * time.Minute)
+	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldBeEmpty)
+
+	now = now.Add(time.Minute)
+	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldBeEmpty)
+
+	// 30 minutes after b stopped it can go again
+	now = now.Add(12 * time.Minute)
+	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldResemble, []string{"b"})
+}
+
+func TestTimeSliceNoSoak(t *testing.T) {
+	s := sprinkler{
+		config: &sprinklerConfig{
+			StartHour:           -1,
+			MaxTimeSliceMinutes: 15,
+			Zones: map[string]ZoneConfig{
+				"a": {Minutes: 40},
+			},
+		},
+		logger: logging.NewTestLogger(t),
+	}
+	f := addDummyPins(&s)
+	defer f()
+
+	ctx := context.Background()
+	now := time.Date(2026, time.June, 18, 4, 0, 0, 0, time.UTC)
+	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldResemble, []string{"a"})
+
+	// nothing else to run and no soak, so a starts a new slice
+	now = now.Add(15 * time.Minute)
+	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldResemble, []string{"a"})
+	test.That(t, s.runningSince["a"], test.ShouldEqual, now)
+}
+
+func TestWindows(t *testing.T) {
+	ctx := context.Background()
+	day := time.Date(2026, time.June, 18, 0, 0, 0, 0, time.UTC)
+
+	s := sprinkler{
+		config: &sprinklerConfig{
+			Windows: []WindowConfig{
+				{Start: "04:00", End: "04:30"},
+				{Start: "20:00", End: "22:00"},
+			},
+			Zones: map[string]ZoneConfig{
+				"a": {Minutes: 20},
+				"b": {Minutes: 40},
+			},
+		},
+		logger: logging.NewTestLogger(t),
+	}
+	f := addDummyPins(&s)
+	defer f()
+
+	// start_hour defaults don't matter once there are windows
+	test.That(t, s.doLoop(ctx, day.Add(time.Hour)), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldBeEmpty)
+
+	test.That(t, s.doLoop(ctx, day.Add(4*time.Hour)), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldResemble, []string{"b"})
+
+	test.That(t, s.doLoop(ctx, day.Add(4*time.Hour+29*time.Minute)), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldResemble, []string{"b"})
+
+	// the window is over, b isn't done but has to stop
+	test.That(t, s.doLoop(ctx, day.Add(4*time.Hour+30*time.Minute)), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldBeEmpty)
+
+	test.That(t, s.doLoop(ctx, day.Add(12*time.Hour)), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldBeEmpty)
+
+	// leftover minutes carry into the evening window
+	test.That(t, s.doLoop(ctx, day.Add(20*time.Hour)), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldResemble, []string{"b"})
+
+	d, err := s.stats.AmountWatered("b", day)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, d, test.ShouldEqual, 30*time.Minute)
+}
+
+func TestWindowValidate(t *testing.T) {
+	cfg := sprinklerConfig{Board: "b", Windows: []WindowConfig{{Start: "04:00", End: "07:00"}}}
+	_, _, err := cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	cfg.Windows = []WindowConfig{{Start: "07:00", End: "04:00"}}
+	_, _, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	cfg.Windows = []WindowConfig{{Start: "4am", End: "07:00"}}
+	_, _, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestRainFreezeSensors(t *testing.T) {
+	ctx := context.Background()
+	s := sprinkler{config: &testSimpleConfig, logger: logging.NewTestLogger(t)}
+	f := addDummyPins(&s)
+	defer f()
+
+	rainSensor := &fake.GPIOPin{}
+	freezeSensor := &fake.GPIOPin{}
+	test.That(t, rainSensor.Set(ctx, true, nil), test.ShouldBeNil)
+	test.That(t, freezeSensor.Set(ctx, true, nil), test.ShouldBeNil)
+	s.rainSensor = rainSensor
+	s.freezeSensor = freezeSensor
+
+	now := time.Now()
+	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldResemble, []string{"b"})
+	test.That(t, s.suspended, test.ShouldEqual, "")
+
+	// the rain sensor opens, everything stops
+	test.That(t, rainSensor.Set(ctx, false, nil), test.ShouldBeNil)
+	now = now.Add(time.Minute)
+	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldBeEmpty)
+	test.That(t, s.suspended, test.ShouldEqual, "rain sensor")
+
+	on, err := zonePin(&s, "b").Get(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, on, test.ShouldBeFalse)
+
+	readings, err := s.Readings(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, readings["suspended"], test.ShouldEqual, "rain sensor")
+
+	test.That(t, freezeSensor.Set(ctx, false, nil), test.ShouldBeNil)
+	test.That(t, s.doLoop(ctx, now.Add(time.Minute)), test.ShouldBeNil)
+	test.That(t, s.suspended, test.ShouldEqual, "freeze sensor")
+
+	test.That(t, rainSensor.Set(ctx, true, nil), test.ShouldBeNil)
+	test.That(t, freezeSensor.Set(ctx, true, nil), test.ShouldBeNil)
+	test.That(t, s.doLoop(ctx, now.Add(2*time.Minute)), test.ShouldBeNil)
+	test.That(t, s.suspended, test.ShouldEqual, "")
+	test.That(t, s.running, test.ShouldResemble, []string{"b"})
+
+	// a zone run by hand keeps going in the rain, but not in a freeze
+	_, err = s.DoCommand(ctx, map[string]interface{}{"cmd": "run", "zone": "a", "minutes": 30.0})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, rainSensor.Set(ctx, false, nil), test.ShouldBeNil)
+	test.That(t, s.doLoop(ctx, time.Now().Add(time.Minute)), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldResemble, []string{"a"})
+
+	test.That(t, freezeSensor.Set(ctx, false, nil), test.ShouldBeNil)
+	test.That(t, s.doLoop(ctx, time.Now().Add(2*time.Minute)), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldBeEmpty)
+	test.That(t, s.suspended, test.ShouldEqual, "freeze sensor")
+	on, err = zonePin(&s, "a").Get(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, on, test.ShouldBeFalse)
+
+	// if we can't read a sensor, we don't water
+	test.That(t, rainSensor.Set(ctx, true, nil), test.ShouldBeNil)
+	s.freezeSensor = &brokenPin{}
+	test.That(t, s.doLoop(ctx, time.Now().Add(3*time.Minute)), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldBeEmpty)
+	test.That(t, s.suspended, test.ShouldEqual, "sensor error")
+}
+
+// brokenPin can't be read
+type brokenPin struct {
+	fake.GPIOPin
+}
+
+func (p *brokenPin) Get(ctx context.Context, extra map[string]interface{}) (bool, error) {
+	return false, errors.New("i2c timeout")
+}
+
+func TestMasterValve(t *testing.T) {
+	ctx := context.Background()
+	s := sprinkler{
+		config: &sprinklerConfig{
+			StartHour:            -1,
+			MasterPreOpenSeconds: 0.05,
+			Zones:                testSimpleConfig.Zones,
+		},
+		logger: logging.NewTestLogger(t),
+	}
+	f := addDummyPins(&s)
+	defer f()
+
+	master := &fake.GPIOPin{}
+	s.masterPin = master
+
+	isOn := func(p board.GPIOPin) bool {
+		v, err := p.Get(ctx, nil)
+		test.That(t, err, test.ShouldBeNil)
+		return v
+	}
+
+	now := time.Now()
+	start := time.Now()
+	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+	test.That(t, time.Since(start), test.ShouldBeGreaterThanOrEqualTo, 50*time.Millisecond)
+	test.That(t, s.running, test.ShouldResemble, []string{"b"})
+	test.That(t, isOn(master), test.ShouldBeTrue)
+	test.That(t, isOn(zonePin(&s, "b")), test.ShouldBeTrue)
+
+	// switching zones keeps the master on, and doesn't wait again
+	start = time.Now()
+	test.That(t, s.stopAllExcept(ctx, why{}, "a"), test.ShouldBeNil)
+	test.That(t, time.Since(start), test.ShouldBeLessThan, 50*time.Millisecond)
+	test.That(t, isOn(master), test.ShouldBeTrue)
+
+	s.pauseTillTime = now.Add(time.Hour)
+	test.That(t, s.doLoop(ctx, now.Add(time.Minute)), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldBeEmpty)
+	test.That(t, isOn(master), test.ShouldBeFalse)
+	for z := range s.valves {
+		test.That(t, isOn(zonePin(&s, z)), test.ShouldBeFalse)
+	}
+}
+
+func TestFlowBudget(t *testing.T) {
+	ctx := context.Background()
+	s := sprinkler{
+		config: &sprinklerConfig{
+			StartHour: -1,
+			MaxFlow:   40,
+			Zones: map[string]ZoneConfig{
+				"spray":  {Minutes: 20, Flow: 30, Priority: 1},
+				"lawn":   {Minutes: 10, Flow: 30},
+				"drip-a": {Minutes: 30, Flow: 4},
+				"drip-b": {Minutes: 60, Flow: 4},
+			},
+		},
+		logger: logging.NewTestLogger(t),
+	}
+	f := addDummyPins(&s)
+	defer f()
+
+	now := time.Now()
+	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldResemble, []string{"spray", "drip-b", "drip-a"})
+
+	for _, z := range s.running {
+		on, err := zonePin(&s, z).Get(ctx, nil)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, on, test.ShouldBeTrue)
+	}
+
+	readings, err := s.Readings(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, readings["running"], test.ShouldEqual, "spray, drip-b, drip-a")
+	test.That(t, readings["running_zones"], test.ShouldResemble, []interface{}{"spray", "drip-b", "drip-a"})
+
+	// spray is done, lawn fits now
+	now = now.Add(21 * time.Minute)
+	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldResemble, []string{"drip-b", "drip-a", "lawn"})
+
+	// lawn and drip-a are done, just drip-b is left
+	now = now.Add(11 * time.Minute)
+	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldResemble, []string{"drip-b"})
+
+	// without a max flow it's one at a time
+	s.config.MaxFlow = 0
+	test.That(t, s.pickNext_inlock(now), test.ShouldResemble, []string{"drip-b"})
+}
+
+func TestFlowBudgetValidate(t *testing.T) {
+	cfg := sprinklerConfig{
+		Board:   "b",
+		MaxFlow: 40,
+		Zones: map[string]ZoneConfig{
+			"spray": {Minutes: 20, Flow: 30},
+			"drip":  {Minutes: 10},
+		},
+	}
+	_, _, err := cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "zone drip")
+
+	cfg.Zones["drip"] = ZoneConfig{Minutes: 10, Flow: 4}
+	_, _, err = cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	// without max_flow there's no budget to need it for
+	cfg.MaxFlow = 0
+	cfg.Zones["drip"] = ZoneConfig{Minutes: 10}
+	_, _, err = cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+}
+
+func TestFlowMeter(t *testing.T) {
+	ctx := context.Background()
+	s := sprinkler{
+		config: &sprinklerConfig{
+			StartHour:               -1,
+			MaxFlow:                 40,
+			FlowMeterPulsesPerLiter: 0.5,
+			Zones: map[string]ZoneConfig{
+				"spray": {Minutes: 20, Flow: 30},
+				"drip":  {Minutes: 10, Flow: 10},
+			},
+		},
+		logger: logging.NewTestLogger(t),
+	}
+	f := addDummyPins(&s)
+	defer f()
+
+	// on the fake board, pin 0 pulses once every time it's read
+	meter, err := fake.NewDigitalInterrupt(board.DigitalInterruptConfig{Name: "meter", Pin: "0"})
+	test.That(t, err, test.ShouldBeNil)
+	s.flowMeter = meter
+
+	now := time.Now()
+	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldResemble, []string{"spray", "drip"})
+
+	// one pulse is 2 liters, split 3:1
+	test.That(t, s.doLoop(ctx, now.Add(time.Minute)), test.ShouldBeNil)
+	spray, err := s.stats.VolumeUsed("spray", now, now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, spray, test.ShouldAlmostEqual, 1.5)
+	drip, err := s.stats.VolumeUsed("drip", now, now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, drip, test.ShouldAlmostEqual, 0.5)
+
+	readings, err := s.Readings(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, readings["spray-liters"], test.ShouldAlmostEqual, 1.5)
+	test.That(t, readings["spray-liters-week"], test.ShouldAlmostEqual, 1.5)
+	test.That(t, readings["spray-liters-month"], test.ShouldAlmostEqual, 1.5)
+
+	// nothing running, the water still gets counted
+	s.pauseTillTime = now.Add(time.Hour)
+	test.That(t, s.doLoop(ctx, now.Add(2*time.Minute)), test.ShouldBeNil)
+	test.That(t, s.doLoop(ctx, now.Add(3*time.Minute)), test.ShouldBeNil)
+	unassigned, err := s.stats.VolumeUsed(unassignedVolume, now, now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, unassigned, test.ShouldAlmostEqual, 2)
+}
+
+// stuckPin is a relay that's welded on
+type stuckPin struct {
+	fake.GPIOPin
+}
+
+func (p *stuckPin) Set(ctx context.Context, high bool, extra map[string]interface{}) error {
+	return nil
+}
+
+func (p *stuckPin) Get(ctx context.Context, extra map[string]interface{}) (bool, error) {
+	return true, nil
+}
+
+func TestPinReadBack(t *testing.T) {
+	ctx := context.Background()
+	s := sprinkler{config: &testSimpleConfig, logger: logging.NewTestLogger(t)}
+	f := addDummyPins(&s)
+	defer f()
+
+	test.That(t, s.stopAllExcept(ctx, why{}, "a", "b", "c"), test.ShouldBeNil)
+	s.valves["a"] = &levelValve{s: &s, zone: "a", pin: &stuckPin{}}
+
+	// a can't go off, but the rest still do
+	err := s.stopAllExcept(ctx, why{})
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "zone (a)")
+	for _, z := range []string{"b", "c"} {
+		on, err := zonePin(&s, z).Get(ctx, nil)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, on, test.ShouldBeFalse)
+	}
+
+	readings, err := s.Readings(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, readings["a-pin-faults"], test.ShouldEqual, pinTries)
+	test.That(t, readings["b-pin-faults"], test.ShouldEqual, 0)
+
+	// a never went off, so that's not in the event log
+	now := time.Now()
+	events, err := s.stats.Events(now.Add(-time.Minute), now.Add(time.Minute))
+	test.That(t, err, test.ShouldBeNil)
+	for _, e := range events {
+		if !e.On {
+			test.That(t, e.Zone, test.ShouldNotEqual, "a")
+		}
+	}
+}
+
+func TestActiveLow(t *testing.T) {
+	ctx := context.Background()
+	activeHigh := false
+	s := sprinkler{
+		config: &sprinklerConfig{
+			StartHour: -1,
+			ActiveLow: true,
+			MasterPin: "m",
+			Zones: map[string]ZoneConfig{
+				"a": {Minutes: 10},
+				"b": {Minutes: 10, ActiveLow: &activeHigh},
+				"c": {Minutes: 10},
+			},
+		},
+		logger: logging.NewTestLogger(t),
+	}
+	f := addDummyPins(&s)
+	defer f()
+	s.masterPin = &fake.GPIOPin{}
+
+	get := func(p board.GPIOPin) bool {
+		v, err := p.Get(ctx, nil)
+		test.That(t, err, test.ShouldBeNil)
+		return v
+	}
+
+	// on startup a low pin means on, so everything has to be driven high
+	test.That(t, s.stopAllExcept(ctx, why{}), test.ShouldBeNil)
+	test.That(t, get(zonePin(&s, "a")), test.ShouldBeTrue)
+	test.That(t, get(zonePin(&s, "b")), test.ShouldBeFalse)
+	test.That(t, get(zonePin(&s, "c")), test.ShouldBeTrue)
+	test.That(t, get(s.masterPin), test.ShouldBeTrue)
+
+	test.That(t, s.stopAllExcept(ctx, why{}, "a", "b"), test.ShouldBeNil)
+	test.That(t, get(zonePin(&s, "a")), test.ShouldBeFalse)
+	test.That(t, get(zonePin(&s, "b")), test.ShouldBeTrue)
+	test.That(t, get(zonePin(&s, "c")), test.ShouldBeTrue)
+	test.That(t, get(s.masterPin), test.ShouldBeFalse)
+}
+
+// testBoard only has gpio pins, made as they're asked for
+type testBoard struct {
+	board.Board
+	pins map[string]*fake.GPIOPin
+}
+
+func (b *testBoard) GPIOPinByName(name string) (board.GPIOPin, error) {
+	if b.pins[name] == nil {
+		b.pins[name] = &fake.GPIOPin{}
+	}
+	return b.pins[name], nil
+}
+
+func TestReconfigure(t *testing.T) {
+	ctx := context.Background()
+	s := sprinkler{config: &sprinklerConfig{}, logger: logging.NewTestLogger(t)}
+	f := addDummyPins(&s)
+	defer f()
+
+	b := &testBoard{pins: map[string]*fake.GPIOPin{}}
+	deps := resource.Dependencies{board.Named("b"): b}
+	reconfigure := func(zones map[string]ZoneConfig) {
+		cfg := &sprinklerConfig{Board: "b", StartHour: -1, DataDir: s.config.DataDir, Zones: zones}
+		test.That(t, s.Reconfigure(ctx, deps, resource.Config{ConvertedAttributes: cfg}), test.ShouldBeNil)
+	}
+	isOn := func(pin string) bool {
+		v, err := b.pins[pin].Get(ctx, nil)
+		test.That(t, err, test.ShouldBeNil)
+		return v
+	}
+
+	reconfigure(map[string]ZoneConfig{"a": {Pin: "1", Minutes: 10}, "b": {Pin: "2", Minutes: 5}})
+	s.pauseTillTime = time.Now().Add(time.Hour)
+	s.forceZone, s.forceTill = "a", time.Now().Add(time.Hour)
+	test.That(t, s.doLoop(ctx, time.Now()), test.ShouldBeNil)
+	test.That(t, isOn("1"), test.ShouldBeTrue)
+	test.That(t, isOn("2"), test.ShouldBeFalse)
+
+	// b went away while it was on, and c is new
+	test.That(t, b.pins["2"].Set(ctx, true, nil), test.ShouldBeNil)
+	reconfigure(map[string]ZoneConfig{"a": {Pin: "1", Minutes: 10}, "c": {Pin: "3", Minutes: 5}})
+	test.That(t, isOn("1"), test.ShouldBeTrue)
+	test.That(t, isOn("2"), test.ShouldBeFalse)
+	test.That(t, isOn("3"), test.ShouldBeFalse)
+	test.That(t, s.running, test.ShouldResemble, []string{"a"})
+	test.That(t, s.forceZone, test.ShouldEqual, "a")
+	test.That(t, s.pauseTillTime.After(time.Now()), test.ShouldBeTrue)
+
+	// a moved to another pin
+	reconfigure(map[string]ZoneConfig{"a": {Pin: "4", Minutes: 10}})
+	test.That(t, isOn("1"), test.ShouldBeFalse)
+	test.That(t, isOn("4"), test.ShouldBeTrue)
+
+	// a latching valve that didn't change keeps knowing where it is
+	latching := ZoneConfig{Valve: valveLatching, OpenPin: "5", ClosePin: "6", Minutes: 10}
+	reconfigure(map[string]ZoneConfig{"a": {Pin: "4", Minutes: 10}, "l": latching})
+	v := s.valves["l"]
+	latching.Minutes = 20
+	reconfigure(map[string]ZoneConfig{"a": {Pin: "4", Minutes: 10}, "l": latching})
+	test.That(t, s.valves["l"], test.ShouldEqual, v)
+}
@@ -0,0 +1,212 @@
+package sprinkler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"go.viam.com/rdk/logging"
+
+	_ "modernc.org/sqlite"
+)
+
+// stores a data_dir can use, picked with store in the config
+const (
+	storeFiles  = "files" // one text file per day, the default
+	storeSQLite = "sqlite"
+)
+
+func openStore(root, kind string, flushInterval time.Duration, logger logging.Logger) (DataAPI, error) {
+	switch kind {
+	case "", storeFiles:
+		return newLocalJSONStore(root, flushInterval, logger)
+	case storeSQLite:
+		return NewSQLiteStore(filepath.Join(root, "sprinkler.db"))
+	}
+	return nil, fmt.Errorf("unknown store [%s]", kind)
+}
+
+// totals kinds, adjustments use their own kind name
+const (
+	totalWatered = "watered" // minutes
+	totalVolume  = "volume"  // liters
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS totals (
+  zone   TEXT NOT NULL,
+  kind   TEXT NOT NULL,
+  day    TEXT NOT NULL,
+  amount REAL NOT NULL,
+  PRIMARY KEY (zone, kind, day)
+);
+CREATE TABLE IF NOT EXISTS events (
+  time    INTEGER NOT NULL,
+  zone    TEXT NOT NULL,
+  on_     INTEGER NOT NULL,
+  cause   TEXT NOT NULL,
+  detail  TEXT NOT NULL,
+  minutes REAL NOT NULL
+);
+CREATE INDEX IF NOT EXISTS events_time ON events (time);
+CREATE TABLE IF NOT EXISTS weather (
+  time        INTEGER NOT NULL,
+  rain_mm     REAL NOT NULL,
+  observed_mm REAL NOT NULL,
+  min_temp    REAL NOT NULL,
+  max_temp    REAL NOT NULL
+);
+CREATE INDEX IF NOT EXISTS weather_time ON weather (time);
+`
+
+// sqliteStore keeps everything in one database, days are local dates like the file names
+type sqliteStore struct {
+	db *sql.DB
+}
+
+func NewSQLiteStore(fn string) (DataAPI, error) {
+	// wal only appends on a write, and synchronous=full keeps it through a power cut
+	db, err := sql.Open("sqlite", fn+"?_pragma=journal_mode(wal)&_pragma=synchronous(full)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	// events come from both the loop and the valves, one connection keeps the writes in line
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(sqliteSchema)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("cannot set up %s: %w", fn, err), db.Close())
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+// Flush has nothing to do, every write is committed
+func (s *sqliteStore) Flush() error {
+	return nil
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *sqliteStore) total(z, kind string, now time.Time) (float64, error) {
+	var amount float64
+	err := s.db.QueryRow("SELECT amount FROM totals WHERE zone = ? AND kind = ? AND day = ?", z, kind, dayString(now)).Scan(&amount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return amount, err
+}
+
+func (s *sqliteStore) addTotal(z, kind string, now time.Time, amount float64) (float64, error) {
+	var total float64
+	err := s.db.QueryRow(`
+INSERT INTO totals (zone, kind, day, amount) VALUES (?, ?, ?, ?)
+ON CONFLICT (zone, kind, day) DO UPDATE SET amount = amount + excluded.amount
+RETURNING amount`, z, kind, dayString(now), amount).Scan(&total)
+	return total, err
+}
+
+func (s *sqliteStore) AmountWatered(z string, now time.Time) (time.Duration, error) {
+	m, err := s.total(z, totalWatered, now)
+	return time.Duration(m * float64(time.Minute)), err
+}
+
+func (s *sqliteStore) AddWatered(z string, now time.Time, amountToMark time.Duration) (time.Duration, error) {
+	m, err := s.addTotal(z, totalWatered, now, amountToMark.Minutes())
+	return time.Duration(m * float64(time.Minute)), err
+}
+
+func (s *sqliteStore) AddAdjustment(z, kind string, now time.Time, amount time.Duration) (time.Duration, error) {
+	m, err := s.addTotal(z, "adjust:"+kind, now, amount.Minutes())
+	return time.Duration(m * float64(time.Minute)), err
+}
+
+func (s *sqliteStore) Adjustments(z string, now time.Time) (map[string]time.Duration, error) {
+	rows, err := s.db.Query("SELECT kind, amount FROM totals WHERE zone = ? AND day = ? AND kind LIKE 'adjust:%'", z, dayString(now))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := map[string]time.Duration{}
+	for rows.Next() {
+		var kind string
+		var m float64
+		err = rows.Scan(&kind, &m)
+		if err != nil {
+			return nil, err
+		}
+		res[kind[len("adjust:"):]] = time.Duration(m * float64(time.Minute))
+	}
+	return res, rows.Err()
+}
+
+func (s *sqliteStore) AddVolume(z string, now time.Time, liters float64) (float64, error) {
+	return s.addTotal(z, totalVolume, now, liters)
+}
+
+func (s *sqliteStore) VolumeUsed(z string, from, to time.Time) (float64, error) {
+	var total float64
+	err := s.db.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM totals WHERE zone = ? AND kind = ? AND day >= ? AND day <= ?",
+		z, totalVolume, dayString(from), dayString(to)).Scan(&total)
+	return total, err
+}
+
+func (s *sqliteStore) AddEvent(e Event) error {
+	_, err := s.db.Exec("INSERT INTO events (time, zone, on_, cause, detail, minutes) VALUES (?, ?, ?, ?, ?, ?)",
+		e.Time.UnixNano(), e.Zone, e.On, e.Cause, e.Detail, e.Minutes)
+	return err
+}
+
+func (s *sqliteStore) Events(from, to time.Time) ([]Event, error) {
+	rows, err := s.db.Query("SELECT time, zone, on_, cause, detail, minutes FROM events WHERE time >= ? AND time <= ? ORDER BY time, rowid",
+		from.UnixNano(), to.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []Event{}
+	for rows.Next() {
+		e := Event{}
+		var t int64
+		err = rows.Scan(&t, &e.Zone, &e.On, &e.Cause, &e.Detail, &e.Minutes)
+		if err != nil {
+			return nil, err
+		}
+		e.Time = time.Unix(0, t)
+		res = append(res, e)
+	}
+	return res, rows.Err()
+}
+
+func (s *sqliteStore) AddWeather(w WeatherSnapshot) error {
+	_, err := s.db.Exec("INSERT INTO weather (time, rain_mm, observed_mm, min_temp, max_temp) VALUES (?, ?, ?, ?, ?)",
+		w.Time.UnixNano(), w.RainMM, w.ObservedMM, w.MinTemp, w.MaxTemp)
+	return err
+}
+
+func (s *sqliteStore) Weather(from, to time.Time) ([]WeatherSnapshot, error) {
+	rows, err := s.db.Query("SELECT time, rain_mm, observed_mm, min_temp, max_temp FROM weather WHERE time >= ? AND time <= ? ORDER BY time, rowid",
+		from.UnixNano(), to.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []WeatherSnapshot{}
+	for rows.Next() {
+		w := WeatherSnapshot{}
+		var t int64
+		err = rows.Scan(&t, &w.RainMM, &w.ObservedMM, &w.MinTemp, &w.MaxTemp)
+		if err != nil {
+			return nil, err
+		}
+		w.Time = time.Unix(0, t)
+		res = append(res, w)
+	}
+	return res, rows.Err()
+}
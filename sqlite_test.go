@@ -0,0 +1,144 @@
+package sprinkler
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/logging"
+
+	"go.viam.com/test"
+)
+
+// testStore is what every DataAPI has to do
+func testStore(t *testing.T, s DataAPI) {
+	day := time.Date(2025, 6, 3, 10, 0, 0, 0, time.Local)
+	next := day.AddDate(0, 0, 1)
+
+	d, err := s.AddWatered("a", day, time.Minute)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, d, test.ShouldEqual, time.Minute)
+	d, err = s.AddWatered("a", day, 90*time.Second)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, d, test.ShouldEqual, 150*time.Second)
+	d, err = s.AmountWatered("a", next)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, d, test.ShouldEqual, 0)
+
+	_, err = s.AddAdjustment("a", adjustRain, day, 3*time.Minute)
+	test.That(t, err, test.ShouldBeNil)
+	d, err = s.AddAdjustment("a", adjustRain, day, time.Minute)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, d, test.ShouldEqual, 4*time.Minute)
+	_, err = s.AddAdjustment("b", adjustHeat, day, time.Minute)
+	test.That(t, err, test.ShouldBeNil)
+	adj, err := s.Adjustments("a", day)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, adj, test.ShouldResemble, map[string]time.Duration{adjustRain: 4 * time.Minute})
+
+	// adjustments aren't run time
+	d, err = s.AmountWatered("a", day)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, d, test.ShouldEqual, 150*time.Second)
+
+	_, err = s.AddVolume("a", day, 10)
+	test.That(t, err, test.ShouldBeNil)
+	l, err := s.AddVolume("a", next, 5)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, l, test.ShouldEqual, 5)
+	l, err = s.VolumeUsed("a", day, next)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, l, test.ShouldEqual, 15)
+	l, err = s.VolumeUsed("a", next, next)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, l, test.ShouldEqual, 5)
+
+	days, err := s.History("a", day, next)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(days), test.ShouldEqual, 2)
+	test.That(t, days[0], test.ShouldResemble, DayTotal{Day: startOfDay(day), Minutes: 2.5, Rain: 4, Liters: 10})
+	test.That(t, days[1], test.ShouldResemble, DayTotal{Day: startOfDay(next), Liters: 5})
+
+	test.That(t, s.AddEvent(Event{Time: day, Zone: "a", On: true, Cause: causeSchedule}), test.ShouldBeNil)
+	test.That(t, s.AddEvent(Event{Time: day.Add(time.Hour), Zone: "a", Cause: causeMark, Minutes: 5}), test.ShouldBeNil)
+	test.That(t, s.AddEvent(Event{Time: next, Zone: "b", Cause: causeFault, Detail: "leak"}), test.ShouldBeNil)
+
+	events, err := s.Events(day, next)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(events), test.ShouldEqual, 3)
+	test.That(t, events[0].Time.Equal(day), test.ShouldBeTrue)
+	test.That(t, events[0].On, test.ShouldBeTrue)
+	test.That(t, events[1].Minutes, test.ShouldEqual, 5)
+	test.That(t, events[2].Detail, test.ShouldEqual, "leak")
+
+	events, err = s.Events(day.Add(time.Minute), day.Add(2*time.Hour))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(events), test.ShouldEqual, 1)
+	test.That(t, events[0].Cause, test.ShouldEqual, causeMark)
+
+	w := WeatherSnapshot{Time: day, RainMM: 2, ObservedMM: 1, MinTemp: 12, MaxTemp: 28}
+	test.That(t, s.AddWeather(w), test.ShouldBeNil)
+	weather, err := s.Weather(day.Add(-time.Hour), next)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(weather), test.ShouldEqual, 1)
+	test.That(t, weather[0].Time.Equal(day), test.ShouldBeTrue)
+	weather[0].Time = day
+	test.That(t, weather[0], test.ShouldResemble, w)
+}
+
+func TestLocalJSONStoreAPI(t *testing.T) {
+	s, err := NewLocalJSONStore(t.TempDir(), logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	defer s.Close()
+	testStore(t, s)
+}
+
+func TestSQLiteStore(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "x.db")
+	s, err := NewSQLiteStore(fn)
+	test.That(t, err, test.ShouldBeNil)
+	testStore(t, s)
+	test.That(t, s.Close(), test.ShouldBeNil)
+
+	// it's all still there when it's opened again
+	s, err = NewSQLiteStore(fn)
+	test.That(t, err, test.ShouldBeNil)
+	defer s.Close()
+	d, err := s.AmountWatered("a", time.Date(2025, 6, 3, 0, 0, 0, 0, time.Local))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, d, test.ShouldEqual, 150*time.Second)
+}
+
+func TestSQLiteSprinkler(t *testing.T) {
+	ctx := context.Background()
+	s := sprinkler{config: &sprinklerConfig{StartHour: -1, Store: storeSQLite, Zones: testSimpleConfig.Zones}, logger: logging.NewTestLogger(t)}
+	f := addDummyPins(&s)
+	defer f()
+
+	_, ok := s.stats.(*sqliteStore)
+	test.That(t, ok, test.ShouldBeTrue)
+
+	now := time.Now()
+	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+	test.That(t, s.doLoop(ctx, now.Add(time.Minute)), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldResemble, []string{"b"})
+
+	d, err := s.stats.AmountWatered("b", now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, d, test.ShouldEqual, time.Minute)
+
+	res, err := s.DoCommand(ctx, map[string]interface{}{"cmd": "history"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(res["events"].([]interface{})), test.ShouldEqual, 1)
+}
+
+func TestStoreValidate(t *testing.T) {
+	cfg := sprinklerConfig{Board: "b", Store: storeSQLite}
+	_, _, err := cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	cfg.Store = "mysql"
+	_, _, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+}
@@ -0,0 +1,54 @@
+package sprinkler
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"time"
+)
+
+// runState is what people told us to do, saved so it survives a restart
+type runState struct {
+	PauseTill time.Time
+	ForceZone string
+	ForceTill time.Time
+	HoldTill  map[string]time.Time
+	Faults    map[string]string
+}
+
+func stateFileName(root string) string {
+	return filepath.Join(root, "state.json")
+}
+
+func (s *sprinkler) loadState_inlock() error {
+	st, ok, err := loadJSONFile[runState](s.config.DataDir, stateFileName(s.config.DataDir), s.logger)
+	if err != nil || !ok {
+		return err
+	}
+
+	s.pauseTillTime = st.PauseTill
+	s.forceZone = st.ForceZone
+	s.forceTill = st.ForceTill
+	if st.HoldTill != nil {
+		s.holdTill = st.HoldTill
+	}
+	if st.Faults != nil {
+		s.faults = st.Faults
+	}
+	return nil
+}
+
+func (s *sprinkler) saveState_inlock() error {
+	st := runState{
+		PauseTill: s.pauseTillTime,
+		ForceZone: s.forceZone,
+		ForceTill: s.forceTill,
+		HoldTill:  s.holdTill,
+		Faults:    s.faults,
+	}
+
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(stateFileName(s.config.DataDir), data)
+}
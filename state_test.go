@@ -0,0 +1,32 @@
+package sprinkler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/logging"
+
+	"go.viam.com/test"
+)
+
+func TestStateSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	s := sprinkler{config: &sprinklerConfig{StartHour: -1, Zones: map[string]ZoneConfig{"a": {Minutes: 10}, "b": {Minutes: 5}}}, logger: logging.NewTestLogger(t)}
+	f := addDummyPins(&s)
+	defer f()
+
+	_, err := s.DoCommand(ctx, map[string]interface{}{"cmd": "pause", "minutes": 30.0})
+	test.That(t, err, test.ShouldBeNil)
+	_, err = s.DoCommand(ctx, map[string]interface{}{"cmd": "run", "zone": "a", "minutes": 5.0})
+	test.That(t, err, test.ShouldBeNil)
+	_, err = s.DoCommand(ctx, map[string]interface{}{"cmd": "stop", "zone": "b"})
+	test.That(t, err, test.ShouldBeNil)
+
+	restarted := sprinkler{config: &sprinklerConfig{DataDir: s.config.DataDir}, logger: s.logger}
+	test.That(t, restarted.init(), test.ShouldBeNil)
+	test.That(t, restarted.pauseTillTime.Equal(s.pauseTillTime), test.ShouldBeTrue)
+	test.That(t, restarted.forceZone, test.ShouldEqual, "a")
+	test.That(t, restarted.forceTill.Equal(s.forceTill), test.ShouldBeTrue)
+	test.That(t, restarted.holdTill["b"].After(time.Now()), test.ShouldBeTrue)
+}
@@ -0,0 +1,292 @@
+package sprinkler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.viam.com/rdk/components/board"
+	toggleswitch "go.viam.com/rdk/components/switch"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/utils"
+)
+
+const (
+	valveLevel    = "level"
+	valveLatching = "latching"
+
+	// DefaultPulseMillis is how long a latching valve gets power to open or close
+	DefaultPulseMillis = 50
+)
+
+// switchPosition is what a switch component is set to for a valve to be open or closed
+func switchPosition(open bool) uint32 {
+	if open {
+		return 1
+	}
+	return 0
+}
+
+// valve opens and closes the water for one zone
+type valve interface {
+	// set opens or closes the valve, and returns true only if it changed it
+	set(ctx context.Context, open bool) (bool, error)
+}
+
+func (z ZoneConfig) validateValve() error {
+	if z.Switch != "" {
+		if z.Valve != "" || z.Pin != "" || z.Board != "" {
+			return fmt.Errorf("a zone with a switch can't have a valve, pin or board")
+		}
+		return nil
+	}
+
+	switch z.Valve {
+	case "", valveLevel:
+		if z.OpenPin != "" || z.ClosePin != "" {
+			return fmt.Errorf("open_pin and close_pin are only for latching valves")
+		}
+	case valveLatching:
+		if z.OpenPin == "" || z.ClosePin == "" {
+			return fmt.Errorf("open_pin and close_pin are required for latching valves")
+		}
+		if z.PulseMillis < 0 {
+			return fmt.Errorf("pulse_ms cannot be negative")
+		}
+	default:
+		return fmt.Errorf("unknown valve [%s], has to be level or latching", z.Valve)
+	}
+	return nil
+}
+
+// sameValve is if two configs drive the same valve the same way
+func (z ZoneConfig) sameValve(o ZoneConfig) bool {
+	return z.Pin == o.Pin && z.Board == o.Board && z.Switch == o.Switch &&
+		z.Valve == o.Valve && z.OpenPin == o.OpenPin && z.ClosePin == o.ClosePin
+}
+
+func (z ZoneConfig) pulse() time.Duration {
+	if z.PulseMillis > 0 {
+		return time.Duration(z.PulseMillis) * time.Millisecond
+	}
+	return DefaultPulseMillis * time.Millisecond
+}
+
+func (s *sprinkler) newValve(deps resource.Dependencies, b board.Board, zone string, z ZoneConfig) (valve, error) {
+	if z.Switch != "" {
+		r, err := deps.Lookup(toggleswitch.Named(z.Switch))
+		if err != nil {
+			return nil, err
+		}
+		return &switchValve{s: s, zone: zone, sw: r.(toggleswitch.Switch)}, nil
+	}
+
+	if z.Board != "" {
+		r, err := deps.Lookup(board.Named(z.Board))
+		if err != nil {
+			return nil, err
+		}
+		b = r.(board.Board)
+	}
+
+	pin := func(name string) (board.GPIOPin, error) {
+		if b == nil {
+			return nil, fmt.Errorf("no board for pin (%s)", name)
+		}
+		p, err := b.GPIOPinByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("error getting pin (%s)", name)
+		}
+		return p, nil
+	}
+
+	if z.Valve == valveLatching {
+		open, err := pin(z.OpenPin)
+		if err != nil {
+			return nil, err
+		}
+		closePin, err := pin(z.ClosePin)
+		if err != nil {
+			return nil, err
+		}
+		return &latchingValve{s: s, zone: zone, openPin: open, closePin: closePin, pulse: z.pulse()}, nil
+	}
+
+	p, err := pin(z.Pin)
+	if err != nil {
+		return nil, err
+	}
+	return &levelValve{s: s, zone: zone, pin: p}, nil
+}
+
+// levelValve is open as long as its pin is on, most 24VAC valves on a relay
+type levelValve struct {
+	s    *sprinkler
+	zone string
+	pin  board.GPIOPin
+}
+
+func (v *levelValve) set(ctx context.Context, open bool) (bool, error) {
+	level := v.s.config.onLevel(v.zone) == open
+	cur, err := v.pin.Get(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	if cur == level {
+		return false, nil
+	}
+	err = v.s.setPin(ctx, v.zone, v.pin, level)
+	return err == nil, err
+}
+
+// latchingValve is a DC solenoid that stays where the last pulse put it. The
+// pins don't say if it's open, so we keep track ourselves.
+type latchingValve struct {
+	s                 *sprinkler
+	zone              string
+	openPin, closePin board.GPIOPin
+	pulse             time.Duration
+
+	lock  sync.Mutex
+	known bool // false till the first pulse, we don't know what it did before we started
+	open  bool
+}
+
+func (v *latchingValve) set(ctx context.Context, open bool) (bool, error) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if v.known && v.open == open {
+		return false, nil
+	}
+
+	p, other := v.closePin, v.openPin
+	if open {
+		p, other = v.openPin, v.closePin
+	}
+
+	on := v.s.config.onLevel(v.zone)
+	if !v.known {
+		// the pins could be anywhere when we start, never power both coils
+		err := v.s.setPin(ctx, v.zone, other, !on)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	err := v.s.setPin(ctx, v.zone, p, on)
+	if err == nil {
+		utils.SelectContextOrWait(ctx, v.pulse)
+	}
+	// whatever happened, don't leave power on the coil
+	err2 := v.s.setPin(ctx, v.zone, p, !on)
+	if err != nil {
+		return false, err
+	}
+	if err2 != nil {
+		return false, err2
+	}
+
+	v.known, v.open = true, open
+	return true, nil
+}
+
+const (
+	// pinFaults key for the master valve
+	masterPinName = "master"
+
+	pinTries        = 3
+	pinRetryBackoff = 50 * time.Millisecond
+)
+
+// setPin sets a pin and reads it back to make sure it took
+func (s *sprinkler) setPin(ctx context.Context, name string, p board.GPIOPin, high bool) error {
+	return s.setVerified(ctx, name,
+		func() error {
+			return p.Set(ctx, high, nil)
+		},
+		func() error {
+			v, err := p.Get(ctx, nil)
+			if err != nil {
+				return err
+			}
+			if v != high {
+				return fmt.Errorf("set to %v but reads %v", high, v)
+			}
+			return nil
+		})
+}
+
+// setVerified sets something and then checks it, one that doesn't take is
+// counted as a fault and tried again
+func (s *sprinkler) setVerified(ctx context.Context, name string, set, check func() error) error {
+	backoff := pinRetryBackoff
+	var err error
+	for try := 0; try < pinTries; try++ {
+		if try > 0 {
+			if !utils.SelectContextOrWait(ctx, backoff) {
+				return ctx.Err()
+			}
+			backoff *= 2
+		}
+
+		err = set()
+		if err == nil {
+			err = check()
+		}
+		if err == nil {
+			return nil
+		}
+		s.pinFault(name, err)
+	}
+	return fmt.Errorf("gave up after %d tries: %w", pinTries, err)
+}
+
+func (s *sprinkler) pinFault(name string, err error) {
+	s.pinFaultsLock.Lock()
+	defer s.pinFaultsLock.Unlock()
+	s.pinFaults[name]++
+	s.logger.Errorf("pin fault %d for %s: %v", s.pinFaults[name], name, err)
+}
+
+func (s *sprinkler) pinFaultCount(name string) int {
+	s.pinFaultsLock.Lock()
+	defer s.pinFaultsLock.Unlock()
+	return s.pinFaults[name]
+}
+
+// switchValve is another component that turns the zone on and off, like a
+// relay expander or a modbus relay module. Position 1 is open, 0 closed.
+type switchValve struct {
+	s    *sprinkler
+	zone string
+	sw   toggleswitch.Switch
+}
+
+func (v *switchValve) set(ctx context.Context, open bool) (bool, error) {
+	want := switchPosition(open)
+	cur, err := v.sw.GetPosition(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	if cur == want {
+		return false, nil
+	}
+
+	err = v.s.setVerified(ctx, v.zone,
+		func() error {
+			return v.sw.SetPosition(ctx, want, nil)
+		},
+		func() error {
+			pos, err := v.sw.GetPosition(ctx, nil)
+			if err != nil {
+				return err
+			}
+			if pos != want {
+				return fmt.Errorf("set to %d but reads %d", want, pos)
+			}
+			return nil
+		})
+	return err == nil, err
+}
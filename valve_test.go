@@ -0,0 +1,138 @@
+package sprinkler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/board/fake"
+	toggleswitch "go.viam.com/rdk/components/switch"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+
+	"go.viam.com/test"
+)
+
+// recordingPin remembers everything it was set to
+type recordingPin struct {
+	fake.GPIOPin
+	sets []bool
+}
+
+func (p *recordingPin) Set(ctx context.Context, high bool, extra map[string]interface{}) error {
+	p.sets = append(p.sets, high)
+	return p.GPIOPin.Set(ctx, high, extra)
+}
+
+func TestLatchingValve(t *testing.T) {
+	ctx := context.Background()
+	s := sprinkler{
+		config: &sprinklerConfig{
+			StartHour: -1,
+			Zones: map[string]ZoneConfig{
+				"a": {Minutes: 10, Valve: valveLatching, OpenPin: "1", ClosePin: "2"},
+			},
+		},
+		logger: logging.NewTestLogger(t),
+	}
+	f := addDummyPins(&s)
+	defer f()
+
+	open, closePin := &recordingPin{}, &recordingPin{}
+	s.valves["a"] = &latchingValve{s: &s, zone: "a", openPin: open, closePin: closePin, pulse: time.Millisecond}
+
+	// we don't know where it was left, so it gets a close pulse
+	test.That(t, s.stopAllExcept(ctx, why{}), test.ShouldBeNil)
+	test.That(t, open.sets, test.ShouldResemble, []bool{false})
+	test.That(t, closePin.sets, test.ShouldResemble, []bool{true, false})
+
+	// after that we know it's closed
+	test.That(t, s.stopAllExcept(ctx, why{}), test.ShouldBeNil)
+	test.That(t, closePin.sets, test.ShouldResemble, []bool{true, false})
+
+	test.That(t, s.stopAllExcept(ctx, why{}, "a"), test.ShouldBeNil)
+	test.That(t, open.sets, test.ShouldResemble, []bool{false, true, false})
+	test.That(t, s.stopAllExcept(ctx, why{}, "a"), test.ShouldBeNil)
+	test.That(t, open.sets, test.ShouldResemble, []bool{false, true, false})
+
+	test.That(t, s.stopAllExcept(ctx, why{}), test.ShouldBeNil)
+	test.That(t, closePin.sets, test.ShouldResemble, []bool{true, false, true, false})
+}
+
+func TestValveValidate(t *testing.T) {
+	test.That(t, ZoneConfig{Pin: "1"}.validateValve(), test.ShouldBeNil)
+	test.That(t, ZoneConfig{Pin: "1", OpenPin: "2"}.validateValve(), test.ShouldNotBeNil)
+	test.That(t, ZoneConfig{Valve: valveLatching, OpenPin: "1"}.validateValve(), test.ShouldNotBeNil)
+	test.That(t, ZoneConfig{Valve: valveLatching, OpenPin: "1", ClosePin: "2"}.validateValve(), test.ShouldBeNil)
+	test.That(t, ZoneConfig{Valve: "solenoid"}.validateValve(), test.ShouldNotBeNil)
+}
+
+type fakeSwitch struct {
+	toggleswitch.Switch
+	pos uint32
+}
+
+func (s *fakeSwitch) SetPosition(ctx context.Context, position uint32, extra map[string]interface{}) error {
+	s.pos = position
+	return nil
+}
+
+func (s *fakeSwitch) GetPosition(ctx context.Context, extra map[string]interface{}) (uint32, error) {
+	return s.pos, nil
+}
+
+func TestSwitchValve(t *testing.T) {
+	ctx := context.Background()
+	s := sprinkler{config: &sprinklerConfig{}, logger: logging.NewTestLogger(t)}
+	f := addDummyPins(&s)
+	defer f()
+
+	sw := &fakeSwitch{}
+	deps := resource.Dependencies{toggleswitch.Named("relays"): sw}
+
+	v, err := s.newValve(deps, nil, "a", ZoneConfig{Switch: "relays"})
+	test.That(t, err, test.ShouldBeNil)
+
+	changed, err := v.set(ctx, true)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, changed, test.ShouldBeTrue)
+	test.That(t, sw.pos, test.ShouldEqual, 1)
+
+	changed, err = v.set(ctx, true)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, changed, test.ShouldBeFalse)
+
+	_, err = v.set(ctx, false)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, sw.pos, test.ShouldEqual, 0)
+
+	_, err = s.newValve(deps, nil, "a", ZoneConfig{Switch: "missing"})
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestValveDependencies(t *testing.T) {
+	cfg := sprinklerConfig{
+		Zones: map[string]ZoneConfig{
+			"a": {Switch: "relays"},
+			"b": {Board: "b2", Pin: "1"},
+			"c": {Switch: "relays"},
+		},
+	}
+	deps, _, err := cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, deps, test.ShouldResemble, []string{"relays", "b2"})
+
+	// the master is on the global board
+	cfg.MasterPin = "5"
+	_, _, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	cfg.Board = "b1"
+	deps, _, err = cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, deps, test.ShouldResemble, []string{"b1", "relays", "b2"})
+
+	cfg.Zones["a"] = ZoneConfig{Switch: "relays", Pin: "2"}
+	_, _, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+}
@@ -0,0 +1,111 @@
+package sprinkler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.viam.com/utils"
+)
+
+// DefaultMaxRunMinutes is the longest a zone can be on in one stretch if the config doesn't say
+const DefaultMaxRunMinutes = 120
+
+// the loop runs every 10 seconds, so it has to be stuck for a while before we do anything
+const minWatchdogSeconds = 30
+
+func (cfg sprinklerConfig) watchdogTimeout() time.Duration {
+	return time.Duration(cfg.WatchdogSeconds * float64(time.Second))
+}
+
+// beat is called every time the loop gets all the way around
+func (s *sprinkler) beat(now time.Time) {
+	s.heartbeat.Store(now.UnixNano())
+}
+
+// runWatchdog turns everything off if the loop stops going around
+func (s *sprinkler) runWatchdog() {
+	for utils.SelectContextOrWait(s.backgroundContext, loopInterval) {
+		s.checkWatchdog(time.Now())
+	}
+}
+
+// checkWatchdog returns true if the loop is stuck
+func (s *sprinkler) checkWatchdog(now time.Time) bool {
+	timeout := time.Duration(s.watchdogTimeout.Load())
+	last := time.Unix(0, s.heartbeat.Load())
+	if timeout == 0 || now.Sub(last) < timeout {
+		return false
+	}
+
+	if !s.watchdogTripped.Swap(true) {
+		s.logger.Errorf("sprinkler loop hasn't run since %v, turning everything off", last)
+	}
+
+	// this doesn't take statsLock, the loop might be stuck holding it
+	var err error
+	if s.valveLock.TryLock() {
+		err = s.setValves(s.backgroundContext, why{at: now, cause: causeFault, detail: "watchdog"})
+		s.valveLock.Unlock()
+	} else {
+		// the loop could be stuck on a relay or a master valve wait, so don't wait for it
+		err = s.forceAllOff(s.backgroundContext)
+	}
+	if err != nil {
+		s.logger.Errorf("watchdog cannot turn everything off: %v", err)
+	}
+	return true
+}
+
+// forceAllOff closes every valve and the master without valveLock. The event
+// log is written under valveLock, so this only goes in the logs.
+func (s *sprinkler) forceAllOff(ctx context.Context) error {
+	s.swapLock.RLock()
+	defer s.swapLock.RUnlock()
+
+	var errs []error
+	for name, v := range s.valves {
+		changed, err := v.set(ctx, false)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cannot turn off zone (%s): %w", name, err))
+		}
+		if changed {
+			s.logger.Warnf("watchdog turned zone off %s", name)
+		}
+	}
+
+	// no post close wait, something is already wrong
+	if s.masterPin != nil {
+		err := s.setPin(ctx, masterPinName, s.masterPin, s.config.ActiveLow)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cannot turn off master pin (%s): %w", s.config.MasterPin, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// onTooLong_inlock is true once a zone has been on for its max run. The
+// schedule takes zones off a loop early, so it's only a fault if something else kept it on.
+func (s *sprinkler) onTooLong_inlock(zone string, now time.Time) bool {
+	since, ok := s.onSince[zone]
+	return ok && now.Sub(since) >= s.config.maxRun(zone)
+}
+
+// checkMaxRun_inlock faults any zone that's been on too long, however it got turned on
+func (s *sprinkler) checkMaxRun_inlock(now time.Time) {
+	for _, z := range s.running {
+		if !s.onTooLong_inlock(z, now) {
+			continue
+		}
+		on := now.Sub(s.onSince[z]).Round(time.Second)
+		s.faults[z] = fmt.Sprintf("on for %v, max is %v", on, s.config.maxRun(z))
+		s.raiseAlert_inlock(now, fmt.Sprintf("zone %s was on for %v, turning it off", z, on))
+		if s.forceZone == z {
+			s.forceZone = ""
+		}
+		if err := s.saveState_inlock(); err != nil {
+			s.logger.Warnf("cannot save state %v", err)
+		}
+	}
+}
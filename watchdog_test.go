@@ -0,0 +1,142 @@
+package sprinkler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/logging"
+
+	"go.viam.com/test"
+)
+
+func TestCloseTurnsOff(t *testing.T) {
+	ctx := context.Background()
+	s := sprinkler{config: &sprinklerConfig{StartHour: -1, Zones: map[string]ZoneConfig{"a": {Minutes: 10}}}, logger: logging.NewTestLogger(t)}
+	f := addDummyPins(&s)
+	defer f()
+
+	test.That(t, s.doLoop(ctx, time.Now()), test.ShouldBeNil)
+	on, err := zonePin(&s, "a").Get(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, on, test.ShouldBeTrue)
+
+	test.That(t, s.Close(ctx), test.ShouldBeNil)
+	on, err = zonePin(&s, "a").Get(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, on, test.ShouldBeFalse)
+}
+
+func TestWatchdog(t *testing.T) {
+	ctx := context.Background()
+	s := sprinkler{
+		config: &sprinklerConfig{
+			StartHour:       -1,
+			WatchdogSeconds: 30,
+			Zones:           map[string]ZoneConfig{"a": {Minutes: 10}},
+		},
+		logger:            logging.NewTestLogger(t),
+		backgroundContext: ctx,
+	}
+	f := addDummyPins(&s)
+	defer f()
+
+	now := time.Now()
+	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+	s.beat(now)
+
+	test.That(t, s.checkWatchdog(now.Add(10*time.Second)), test.ShouldBeFalse)
+	on, err := zonePin(&s, "a").Get(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, on, test.ShouldBeTrue)
+
+	// the loop got stuck
+	test.That(t, s.checkWatchdog(now.Add(31*time.Second)), test.ShouldBeTrue)
+	on, err = zonePin(&s, "a").Get(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, on, test.ShouldBeFalse)
+
+	// once it's unstuck, the zone goes back on even though it never stopped running
+	test.That(t, s.doLoop(ctx, now.Add(40*time.Second)), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldResemble, []string{"a"})
+	on, err = zonePin(&s, "a").Get(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, on, test.ShouldBeTrue)
+
+	// stuck setting valves, the watchdog doesn't wait for it
+	s.valveLock.Lock()
+	test.That(t, s.checkWatchdog(now.Add(80*time.Second)), test.ShouldBeTrue)
+	s.valveLock.Unlock()
+	on, err = zonePin(&s, "a").Get(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, on, test.ShouldBeFalse)
+}
+
+func TestWatchdogValidate(t *testing.T) {
+	cfg := sprinklerConfig{Board: "b", WatchdogSeconds: 10}
+	_, _, err := cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	cfg.WatchdogSeconds = 60
+	_, _, err = cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+}
+
+func TestMaxRun(t *testing.T) {
+	ctx := context.Background()
+	s := sprinkler{
+		config: &sprinklerConfig{
+			StartHour:     -1,
+			MaxRunMinutes: 30,
+			Zones:         map[string]ZoneConfig{"a": {Minutes: 100}},
+		},
+		logger: logging.NewTestLogger(t),
+	}
+	f := addDummyPins(&s)
+	defer f()
+
+	start := time.Date(2026, time.June, 18, 1, 0, 0, 0, time.Local)
+	now := start
+	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldResemble, []string{"a"})
+
+	// the schedule takes it off before it gets there, and it has to rest as long before it goes again
+	var onSince, lastOff time.Time
+	for ; now.Before(start.Add(4 * time.Hour)); now = now.Add(loopInterval) {
+		test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+		if len(s.running) == 0 {
+			if !onSince.IsZero() {
+				lastOff, onSince = now, time.Time{}
+			}
+			continue
+		}
+		if onSince.IsZero() {
+			if !lastOff.IsZero() {
+				test.That(t, now.Sub(lastOff), test.ShouldBeGreaterThanOrEqualTo, 30*time.Minute)
+			}
+			onSince = now
+		}
+		test.That(t, now.Sub(onSince), test.ShouldBeLessThanOrEqualTo, 30*time.Minute)
+	}
+	test.That(t, s.faults, test.ShouldBeEmpty)
+	ran, err := s.stats.AmountWatered("a", start)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, ran, test.ShouldBeGreaterThanOrEqualTo, 100*time.Minute)
+
+	// a forced run doesn't get that
+	s.forceZone = "a"
+	s.forceTill = now.Add(100000 * time.Minute)
+	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+	test.That(t, s.doLoop(ctx, now.Add(40*time.Minute)), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldBeEmpty)
+	test.That(t, s.forceZone, test.ShouldEqual, "")
+	test.That(t, s.alert, test.ShouldNotEqual, "")
+
+	on, err := zonePin(&s, "a").Get(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, on, test.ShouldBeFalse)
+
+	readings, err := s.Readings(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, readings["a-fault"], test.ShouldNotEqual, "")
+}
@@ -0,0 +1,240 @@
+package sprinkler
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	weatherNOAA      = "noaa"
+	weatherOpenMeteo = "open-meteo"
+	weatherFile      = "file"
+)
+
+type weatherSummary struct {
+	RainMM  float64
+	MinTemp float64 // celsius
+	MaxTemp float64 // celsius
+}
+
+type HourlyWeather struct {
+	Time            time.Time `json:"time"`
+	PrecipitationMM float64   `json:"precipitation_mm"`
+	TemperatureC    float64   `json:"temperature_c"`
+	Humidity        float64   `json:"humidity"`   // percent
+	WindSpeed       float64   `json:"wind_speed"` // m/s
+}
+
+type WeatherProvider interface {
+	// Forecast returns hourly weather, it can include hours that have already happened.
+	Forecast(ctx context.Context) ([]HourlyWeather, error)
+}
+
+// newWeatherProvider returns nil if there isn't enough config to get the weather
+func newWeatherProvider(cfg *sprinklerConfig) (WeatherProvider, error) {
+	switch cfg.Weather {
+	case "", weatherNOAA:
+		if cfg.Lat == "" || cfg.Long == "" {
+			return nil, nil
+		}
+		return &noaaWeather{lat: cfg.Lat, long: cfg.Long}, nil
+	case weatherOpenMeteo:
+		if cfg.Lat == "" || cfg.Long == "" {
+			return nil, nil
+		}
+		return &openMeteoWeather{lat: cfg.Lat, long: cfg.Long, baseURL: openMeteoURL}, nil
+	case weatherFile:
+		if cfg.WeatherFile == "" {
+			return nil, fmt.Errorf("weather_file is required for the file weather provider")
+		}
+		return &fileWeather{fn: cfg.WeatherFile}, nil
+	}
+	return nil, fmt.Errorf("unknown weather provider [%s]", cfg.Weather)
+}
+
+// summarizeWeather looks at the next hours from now
+func summarizeWeather(hourly []HourlyWeather, now time.Time, hours int) weatherSummary {
+	start := now.Truncate(time.Hour)
+	end := now.Add(time.Duration(hours) * time.Hour)
+
+	w := weatherSummary{}
+	first := true
+	for _, h := range hourly {
+		if h.Time.Before(start) || h.Time.After(end) {
+			continue
+		}
+
+		w.RainMM += h.PrecipitationMM
+
+		if first || h.TemperatureC > w.MaxTemp {
+			w.MaxTemp = h.TemperatureC
+		}
+		if first || h.TemperatureC < w.MinTemp {
+			w.MinTemp = h.TemperatureC
+		}
+		first = false
+	}
+	return w
+}
+
+// ----
+
+const openMeteoURL = "https://api.open-meteo.com/v1/forecast"
+
+type openMeteoWeather struct {
+	lat, long string
+	baseURL   string
+}
+
+type openMeteoResponse struct {
+	Hourly struct {
+		Time          []string  `json:"time"`
+		Temperature   []float64 `json:"temperature_2m"`
+		Humidity      []float64 `json:"relative_humidity_2m"`
+		Precipitation []float64 `json:"precipitation"`
+		WindSpeed     []float64 `json:"wind_speed_10m"`
+	} `json:"hourly"`
+}
+
+func (w *openMeteoWeather) Forecast(ctx context.Context) ([]HourlyWeather, error) {
+	q := url.Values{}
+	q.Set("latitude", w.lat)
+	q.Set("longitude", w.long)
+	q.Set("hourly", "temperature_2m,relative_humidity_2m,precipitation,wind_speed_10m")
+	q.Set("wind_speed_unit", "ms")
+	q.Set("timezone", "GMT")
+	q.Set("forecast_days", "2")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, w.baseURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get open-meteo forecast for %v, %v %w", w.lat, w.long, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("open-meteo returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	var r openMeteoResponse
+	err = json.NewDecoder(resp.Body).Decode(&r)
+	if err != nil {
+		return nil, fmt.Errorf("bad open-meteo response: %w", err)
+	}
+
+	h := r.Hourly
+	n := len(h.Time)
+	if len(h.Temperature) != n || len(h.Humidity) != n || len(h.Precipitation) != n || len(h.WindSpeed) != n {
+		return nil, fmt.Errorf("open-meteo response has mismatched hourly data")
+	}
+
+	all := []HourlyWeather{}
+	for i, ts := range h.Time {
+		t, err := time.ParseInLocation("2006-01-02T15:04", ts, time.UTC)
+		if err != nil {
+			return nil, fmt.Errorf("bad open-meteo time [%s] %w", ts, err)
+		}
+		all = append(all, HourlyWeather{
+			Time:            t,
+			PrecipitationMM: h.Precipitation[i],
+			TemperatureC:    h.Temperature[i],
+			Humidity:        h.Humidity[i],
+			WindSpeed:       h.WindSpeed[i],
+		})
+	}
+	return all, nil
+}
+
+// ----
+
+// fileWeather reads the forecast from a local .json or .csv file
+type fileWeather struct {
+	fn string
+}
+
+func (w *fileWeather) Forecast(ctx context.Context) ([]HourlyWeather, error) {
+	data, err := os.ReadFile(w.fn)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(w.fn)) {
+	case ".json":
+		all := []HourlyWeather{}
+		err = json.Unmarshal(data, &all)
+		if err != nil {
+			return nil, fmt.Errorf("bad weather file %s: %w", w.fn, err)
+		}
+		return all, nil
+	case ".csv":
+		return weatherFromCSV(string(data))
+	}
+	return nil, fmt.Errorf("weather file %s has to be .json or .csv", w.fn)
+}
+
+// weatherFromCSV wants a header with time,precipitation_mm,temperature_c,humidity,wind_speed in any order
+func weatherFromCSV(raw string) ([]HourlyWeather, error) {
+	records, err := csv.NewReader(strings.NewReader(raw)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("weather csv is empty")
+	}
+
+	columns := map[string]int{}
+	for i, c := range records[0] {
+		columns[strings.TrimSpace(c)] = i
+	}
+	timeColumn, ok := columns["time"]
+	if !ok {
+		return nil, fmt.Errorf("weather csv needs a time column")
+	}
+
+	float := func(row []string, name string) (float64, error) {
+		i, ok := columns[name]
+		if !ok {
+			return 0, nil
+		}
+		return strconv.ParseFloat(strings.TrimSpace(row[i]), 64)
+	}
+
+	all := []HourlyWeather{}
+	for _, row := range records[1:] {
+		t, err := time.Parse(time.RFC3339, strings.TrimSpace(row[timeColumn]))
+		if err != nil {
+			return nil, fmt.Errorf("bad time in weather csv %v", err)
+		}
+
+		h := HourlyWeather{Time: t}
+		if h.PrecipitationMM, err = float(row, "precipitation_mm"); err != nil {
+			return nil, err
+		}
+		if h.TemperatureC, err = float(row, "temperature_c"); err != nil {
+			return nil, err
+		}
+		if h.Humidity, err = float(row, "humidity"); err != nil {
+			return nil, err
+		}
+		if h.WindSpeed, err = float(row, "wind_speed"); err != nil {
+			return nil, err
+		}
+		all = append(all, h)
+	}
+	return all, nil
+}
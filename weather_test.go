@@ -0,0 +1,88 @@
+package sprinkler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.viam.com/test"
+)
+
+func TestFileWeather(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, time.June, 18, 0, 15, 0, 0, time.UTC)
+
+	for _, fn := range []string{"testdata/forecast.json", "testdata/forecast.csv"} {
+		t.Run(fn, func(t *testing.T) {
+			hourly, err := (&fileWeather{fn: fn}).Forecast(ctx)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, len(hourly), test.ShouldEqual, 24)
+			test.That(t, hourly[3].Humidity, test.ShouldEqual, 60)
+			test.That(t, hourly[3].WindSpeed, test.ShouldEqual, 2.5)
+
+			w := summarizeWeather(hourly, now, 24)
+			test.That(t, w.RainMM, test.ShouldAlmostEqual, 5)
+			test.That(t, w.MinTemp, test.ShouldAlmostEqual, 14)
+			test.That(t, w.MaxTemp, test.ShouldAlmostEqual, 26)
+
+			// only the next few hours
+			w = summarizeWeather(hourly, now.Add(15*time.Hour), 2)
+			test.That(t, w.RainMM, test.ShouldAlmostEqual, 3)
+		})
+	}
+
+	_, err := (&fileWeather{fn: "testdata/nope.json"}).Forecast(ctx)
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestOpenMeteoWeather(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("latitude") != "40.5" {
+			http.Error(w, "bad latitude", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"hourly": {
+			"time": ["2026-06-18T00:00", "2026-06-18T01:00"],
+			"temperature_2m": [15.5, 14.0],
+			"relative_humidity_2m": [80, 85],
+			"precipitation": [0.2, 1.1],
+			"wind_speed_10m": [3.1, 2.0]
+		}}`)
+	}))
+	defer srv.Close()
+
+	w := &openMeteoWeather{lat: "40.5", long: "-73.5", baseURL: srv.URL}
+	hourly, err := w.Forecast(context.Background())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, hourly, test.ShouldResemble, []HourlyWeather{
+		{Time: time.Date(2026, time.June, 18, 0, 0, 0, 0, time.UTC), PrecipitationMM: 0.2, TemperatureC: 15.5, Humidity: 80, WindSpeed: 3.1},
+		{Time: time.Date(2026, time.June, 18, 1, 0, 0, 0, time.UTC), PrecipitationMM: 1.1, TemperatureC: 14.0, Humidity: 85, WindSpeed: 2.0},
+	})
+
+	w.lat = "0"
+	_, err = w.Forecast(context.Background())
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestNewWeatherProvider(t *testing.T) {
+	w, err := newWeatherProvider(&sprinklerConfig{})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, w, test.ShouldBeNil)
+
+	w, err = newWeatherProvider(&sprinklerConfig{Lat: "40.5", Long: "-73.5"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, w, test.ShouldHaveSameTypeAs, &noaaWeather{})
+
+	w, err = newWeatherProvider(&sprinklerConfig{Lat: "40.5", Long: "-73.5", Weather: "open-meteo"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, w, test.ShouldHaveSameTypeAs, &openMeteoWeather{})
+
+	_, err = newWeatherProvider(&sprinklerConfig{Weather: "file"})
+	test.That(t, err, test.ShouldNotBeNil)
+
+	_, err = newWeatherProvider(&sprinklerConfig{Weather: "magic"})
+	test.That(t, err, test.ShouldNotBeNil)
+}
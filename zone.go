@@ -0,0 +1,130 @@
+package sprinkler
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"go.viam.com/rdk/components/sensor"
+	toggleswitch "go.viam.com/rdk/components/switch"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/utils"
+)
+
+var ZoneModel = resource.ModelNamespace("erh").WithFamily("sprinkler").WithModel("zone")
+
+// DefaultZoneSwitchMinutes is how long a zone runs when its switch is turned on
+const DefaultZoneSwitchMinutes = 10
+
+type zoneSwitchConfig struct {
+	Sprinkler string
+	Zone      string
+	Minutes   float64 // how long to run when turned on, default 10
+}
+
+func (cfg zoneSwitchConfig) Validate(path string) ([]string, []string, error) {
+	if cfg.Sprinkler == "" {
+		return nil, nil, utils.NewConfigValidationFieldRequiredError(path, "sprinkler")
+	}
+	if cfg.Zone == "" {
+		return nil, nil, utils.NewConfigValidationFieldRequiredError(path, "zone")
+	}
+	if cfg.Minutes < 0 {
+		return nil, nil, fmt.Errorf("minutes cannot be negative")
+	}
+	return []string{cfg.Sprinkler}, nil, nil
+}
+
+func init() {
+	resource.RegisterComponent(
+		toggleswitch.API,
+		ZoneModel,
+		resource.Registration[toggleswitch.Switch, *zoneSwitchConfig]{
+			Constructor: newZoneSwitch,
+		})
+}
+
+func newZoneSwitch(ctx context.Context, deps resource.Dependencies, config resource.Config, logger logging.Logger) (toggleswitch.Switch, error) {
+	conf, err := resource.NativeConfig[*zoneSwitchConfig](config)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := deps.Lookup(sensor.Named(conf.Sprinkler))
+	if err != nil {
+		return nil, err
+	}
+
+	z := &zoneSwitch{
+		name:      config.ResourceName(),
+		sprinkler: r.(sensor.Sensor),
+		zone:      conf.Zone,
+		minutes:   conf.Minutes,
+	}
+	if z.minutes == 0 {
+		z.minutes = DefaultZoneSwitchMinutes
+	}
+
+	order, err := z.sprinkler.DoCommand(ctx, map[string]interface{}{"cmd": "order"})
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(coerceorder(order["order"]), z.zone) {
+		return nil, fmt.Errorf("sprinkler %s has no zone %s", conf.Sprinkler, z.zone)
+	}
+
+	return z, nil
+}
+
+// zoneSwitch is one zone of a sprinkler as a switch, 0 is off and 1 is on.
+// It goes through the sprinkler's run and stop commands, so the time still counts.
+type zoneSwitch struct {
+	resource.AlwaysRebuild
+	resource.TriviallyCloseable
+
+	name      resource.Name
+	sprinkler sensor.Sensor
+	zone      string
+	minutes   float64
+}
+
+func (z *zoneSwitch) Name() resource.Name {
+	return z.name
+}
+
+func (z *zoneSwitch) Status(ctx context.Context) (map[string]interface{}, error) {
+	return map[string]interface{}{}, nil
+}
+
+func (z *zoneSwitch) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	return nil, fmt.Errorf("zone switch doesn't understand cmd [%s]", cmd["cmd"])
+}
+
+func (z *zoneSwitch) SetPosition(ctx context.Context, position uint32, extra map[string]interface{}) error {
+	switch position {
+	case 0:
+		_, err := z.sprinkler.DoCommand(ctx, map[string]interface{}{"cmd": "stop", "zone": z.zone})
+		return err
+	case 1:
+		_, err := z.sprinkler.DoCommand(ctx, map[string]interface{}{"cmd": "run", "zone": z.zone, "minutes": z.minutes})
+		return err
+	}
+	return fmt.Errorf("zone switch position has to be 0 or 1, not %d", position)
+}
+
+func (z *zoneSwitch) GetPosition(ctx context.Context, extra map[string]interface{}) (uint32, error) {
+	readings, err := z.sprinkler.Readings(ctx, extra)
+	if err != nil {
+		return 0, err
+	}
+	running, ok := readings["running_zones"]
+	if !ok {
+		return 0, fmt.Errorf("sprinkler readings have no running_zones")
+	}
+	return switchPosition(slices.Contains(coerceorder(running), z.zone)), nil
+}
+
+func (z *zoneSwitch) GetNumberOfPositions(ctx context.Context, extra map[string]interface{}) (uint32, []string, error) {
+	return 2, []string{"off", "on"}, nil
+}
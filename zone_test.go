@@ -0,0 +1,84 @@
+package sprinkler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/sensor"
+	toggleswitch "go.viam.com/rdk/components/switch"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+
+	"go.viam.com/test"
+)
+
+func TestZoneSwitch(t *testing.T) {
+	ctx := context.Background()
+	logger := logging.NewTestLogger(t)
+	s := sprinkler{config: &sprinklerConfig{StartHour: -1, Zones: map[string]ZoneConfig{"a": {Minutes: 10}}}, logger: logger}
+	f := addDummyPins(&s)
+	defer f()
+
+	deps := resource.Dependencies{sensor.Named("sp"): &s}
+	newSwitch := func(zone string) (toggleswitch.Switch, error) {
+		return newZoneSwitch(ctx, deps, resource.Config{
+			Name:                "z",
+			ConvertedAttributes: &zoneSwitchConfig{Sprinkler: "sp", Zone: zone},
+		}, logger)
+	}
+
+	_, err := newSwitch("nope")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	sw, err := newSwitch("a")
+	test.That(t, err, test.ShouldBeNil)
+
+	n, labels, err := sw.GetNumberOfPositions(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, n, test.ShouldEqual, 2)
+	test.That(t, labels, test.ShouldResemble, []string{"off", "on"})
+
+	// it's paused, so only the switch can turn it on
+	now := time.Now()
+	s.pauseTillTime = now.Add(time.Hour)
+	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+	pos, err := sw.GetPosition(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, pos, test.ShouldEqual, 0)
+
+	test.That(t, sw.SetPosition(ctx, 1, nil), test.ShouldBeNil)
+	test.That(t, s.forceZone, test.ShouldEqual, "a")
+	test.That(t, s.doLoop(ctx, now), test.ShouldBeNil)
+	test.That(t, s.doLoop(ctx, now.Add(time.Minute)), test.ShouldBeNil)
+	pos, err = sw.GetPosition(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, pos, test.ShouldEqual, 1)
+
+	// the time it ran by hand is in the ledger like any other
+	ran, err := s.stats.AmountWatered("a", now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, ran, test.ShouldEqual, time.Minute)
+
+	// off by hand keeps it off for the day, even once the pause is over
+	test.That(t, sw.SetPosition(ctx, 0, nil), test.ShouldBeNil)
+	s.pauseTillTime = time.Time{}
+	test.That(t, s.doLoop(ctx, now.Add(2*time.Minute)), test.ShouldBeNil)
+	test.That(t, s.running, test.ShouldBeEmpty)
+	pos, err = sw.GetPosition(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, pos, test.ShouldEqual, 0)
+
+	test.That(t, sw.SetPosition(ctx, 2, nil), test.ShouldNotBeNil)
+}
+
+func TestZoneSwitchValidate(t *testing.T) {
+	_, _, err := zoneSwitchConfig{Zone: "a"}.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+	_, _, err = zoneSwitchConfig{Sprinkler: "sp"}.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	deps, _, err := zoneSwitchConfig{Sprinkler: "sp", Zone: "a"}.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, deps, test.ShouldResemble, []string{"sp"})
+}